@@ -1,21 +1,21 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
+	"time"
 
-	"github.com/AlecAivazis/survey/v2"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
 	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
-
-	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-var bpfMapPressureCmd = &cobra.Command{
-	Use:   "bpf-map-pressure",
-	Short: "Check BPF map pressure across all nodes",
-	Long: `Analyze cluster nodes to identify BPF map pressure by checking core BPF maps under /sys/fs/bpf/tc/globals.
+func init() {
+	registerCheck(check.Definition{
+		Name:  "bpf-map-pressure",
+		Short: "Check BPF map pressure across all nodes",
+		Long: `Analyze cluster nodes to identify BPF map pressure by checking core BPF maps under /sys/fs/bpf/tc/globals.
 
-This command check the usage of core BPF maps used by Cilium.
+This command check the usage of the BPF maps used by Cilium for connection tracking,
+NAT, load balancing, fragments, the IP cache, endpoints and tunnels.
 It will show the current usage and maximum capacity of each map, helping identify
 potential pressure points in the BPF map system.
 
@@ -25,37 +25,81 @@ Example:
 
   # Check BPF map pressure for a specific node
   kubectl-cilium bpf-map-pressure --nodename=node-1
-`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		confirm := false
-		prompt := &survey.Confirm{
-			Message: `This command create inspector pods on all nodes to check BPF map pressure. And it may consume CPU resource (200m core limit)
+
+  # Check the nodes of a node pool, or a random sample of 10 ready nodes
+  kubectl-cilium bpf-map-pressure -l pool=gpu
+  kubectl-cilium bpf-map-pressure --only-ready --sample 10
+
+  # Print the result as JSON for other tools
+  kubectl-cilium bpf-map-pressure -o json
+
+  # Warn from 70% and report Critical from 85%
+  kubectl-cilium bpf-map-pressure --warning-threshold=0.7 --critical-threshold=0.85
+
+  # Run without the confirmation prompt, e.g. in a CI pipeline
+  kubectl-cilium bpf-map-pressure --yes -o json
+
+  # Also check the per-endpoint policy maps and the pods they belong to
+  kubectl-cilium bpf-map-pressure --policy-maps
+
+  # Check the load balancer maps and every conntrack map
+  kubectl-cilium bpf-map-pressure --map 'cilium_lb4_*' --map 'cilium_ct*'
+
+  # Check every pinned map
+  kubectl-cilium bpf-map-pressure --all-maps
+
+  # Run bpftool in the cilium-agent containers without creating any pods
+  kubectl-cilium bpf-map-pressure --method=agent-exec
+
+  # Re-scan every 30 seconds and show how the maps change until interrupted
+  kubectl-cilium bpf-map-pressure --watch --interval=30s
+
+` + exitCodesHelp,
+		Prompt: `This command runs bpftool on all nodes, in the cilium-agent containers or in inspector pods (see --method), to check BPF map pressure. And it may consume CPU resource (200m core limit by default, see --inspector-cpu-limit)
 Do you want to continue?`,
-		}
-		err := survey.AskOne(prompt, &confirm)
-		if err != nil {
-			return err
-		}
-		if !confirm {
-			fmt.Println("Aborted.")
-			os.Exit(0)
-		}
-
-		kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
-		nodeName, _ := cmd.Flags().GetString("nodename")
-
-		s, err := pressure.NewScanner(nil, nil, kubeconfig)
-		if err != nil {
-			return err
-		}
-		err = s.Validate()
-		if err != nil {
-			return err
-		}
-		return s.Run(nodeName)
-	},
+		WatchInterval: 30 * time.Second,
+		StoresMaps:    true,
+		AddFlags:      addPressureFlags,
+		New: func(env *check.Env, opts check.Options, flags *pflag.FlagSet) (check.Check, error) {
+			return newPressureScanner(env, opts, flags)
+		},
+	})
 }
 
-func init() {
-	rootCmd.AddCommand(bpfMapPressureCmd)
+// addPressureFlags adds the flags of the commands that scan the maps with the
+// pressure scanner.
+func addPressureFlags(flags *pflag.FlagSet) {
+	addMapFlags(flags)
+	addBackendFlags(flags)
+	addInspectorFlags(flags)
+}
+
+// pressureOptionsFromFlags parses the flags added by addPressureFlags.
+func pressureOptionsFromFlags(flags *pflag.FlagSet, opts check.Options) (pressure.Options, error) {
+	method, source, err := backendFromFlags(flags)
+	if err != nil {
+		return pressure.Options{}, err
+	}
+	inspector, err := inspectorFromFlags(flags)
+	if err != nil {
+		return pressure.Options{}, err
+	}
+
+	scanOpts := pressure.Options{Options: opts, Method: method, Source: source, Inspector: inspector}
+	applyMapFlags(flags, &scanOpts)
+	return scanOpts, nil
+}
+
+// newPressureScanner creates a validated pressure scanner from the flags added
+// by addPressureFlags.
+func newPressureScanner(env *check.Env, opts check.Options, flags *pflag.FlagSet) (*pressure.Scanner, error) {
+	scanOpts, err := pressureOptionsFromFlags(flags, opts)
+	if err != nil {
+		return nil, err
+	}
+	s, err := pressure.NewScanner(env, scanOpts)
+	if err != nil {
+		return nil, err
+	}
+	return s, s.Validate()
 }
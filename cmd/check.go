@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// registerCheck registers a check and adds its command.
+func registerCheck(def check.Definition) {
+	check.Register(def)
+	rootCmd.AddCommand(newCheckCmd(def))
+}
+
+// newCheckCmd generates the command of a check. It shares the output,
+// threshold, node and concurrency flags of the root command, and adds --watch
+// and --interval to the checks that can watch.
+func newCheckCmd(def check.Definition) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   def.Name,
+		Short: def.Short,
+		Long:  def.Long,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := checkOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			nodes, err := nodeFilterFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+
+			var watch bool
+			interval := def.WatchInterval
+			if def.WatchInterval != 0 {
+				watch, _ = cmd.Flags().GetBool("watch")
+				interval, _ = cmd.Flags().GetDuration("interval")
+			}
+			if watch && opts.Output == output.Wide {
+				return fmt.Errorf("--watch does not support %s output", output.Wide)
+			}
+			if watch && interval <= 0 {
+				return fmt.Errorf("interval %s must be positive", interval)
+			}
+
+			contexts, err := contextsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			if watch && len(contexts) > 0 {
+				return fmt.Errorf("--watch does not support multiple contexts")
+			}
+			if len(contexts) > 0 {
+				return runContexts(cmd, def, opts, nodes, contexts)
+			}
+
+			env, err := envFromFlags()
+			if err != nil {
+				return err
+			}
+			c, err := def.New(env, opts, cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			confirm, err := confirmRun(cmd, def.Prompt)
+			if err != nil {
+				return err
+			}
+			if !confirm {
+				return nil
+			}
+
+			ctx, stop := scanContext()
+			defer stop()
+			if watch {
+				return c.(check.Watcher).Watch(ctx, nodes, interval)
+			}
+			report, err := check.Run(ctx, c, nodes, os.Stdout, opts.Output)
+			if err != nil {
+				return err
+			}
+			return exitWithStatuses(cmd, check.Statuses(report))
+		},
+	}
+
+	if def.AddFlags != nil {
+		def.AddFlags(cmd.Flags())
+	}
+	if def.WatchInterval != 0 {
+		cmd.Flags().BoolP("watch", "w", false, "Keep the inspector pods and re-scan every --interval until interrupted")
+		cmd.Flags().Duration("interval", def.WatchInterval, "Time between scans in --watch mode")
+	}
+	addContextsFlags(cmd.Flags())
+	return cmd
+}
+
+// checkOptionsFromFlags parses the root flags shared by all checks.
+func checkOptionsFromFlags(cmd *cobra.Command) (check.Options, error) {
+	outputFlag, _ := cmd.Flags().GetString("output")
+	format, err := output.ParseFormat(outputFlag)
+	if err != nil {
+		return check.Options{}, err
+	}
+	thresholds, err := thresholdsFromFlags(cmd)
+	if err != nil {
+		return check.Options{}, err
+	}
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	if concurrency <= 0 {
+		return check.Options{}, fmt.Errorf("concurrency %d must be positive", concurrency)
+	}
+	return check.Options{Output: format, Thresholds: thresholds, Concurrency: concurrency}, nil
+}
+
+// nodeFilterFromFlags parses the node selection flags of the root command.
+func nodeFilterFromFlags(cmd *cobra.Command) (check.NodeFilter, error) {
+	flags := cmd.Flags()
+	filter := check.NodeFilter{Seed: uint64(time.Now().UnixNano())}
+	filter.Names, _ = flags.GetStringSlice("nodename")
+	filter.Selector, _ = flags.GetString("selector")
+	filter.ExcludeUnschedulable, _ = flags.GetBool("exclude-unschedulable")
+	filter.OnlyReady, _ = flags.GetBool("only-ready")
+	filter.Sample, _ = flags.GetInt("sample")
+
+	if _, err := labels.Parse(filter.Selector); err != nil {
+		return check.NodeFilter{}, fmt.Errorf("invalid --selector %q: %w", filter.Selector, err)
+	}
+	pattern, _ := flags.GetString("node-pattern")
+	if pattern != "" {
+		var err error
+		filter.Pattern, err = regexp.Compile(pattern)
+		if err != nil {
+			return check.NodeFilter{}, fmt.Errorf("invalid --node-pattern %q: %w", pattern, err)
+		}
+	}
+	if filter.Sample < 0 {
+		return check.NodeFilter{}, fmt.Errorf("sample %d must not be negative", filter.Sample)
+	}
+	return filter, nil
+}
+
+// envFromFlags builds the clients from the kubectl flags of the root command.
+func envFromFlags() (*check.Env, error) {
+	return check.NewEnv(kubeConfigFlags)
+}
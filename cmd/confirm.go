@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// confirmRun asks the user to confirm before a scan starts. The prompt is
+// skipped with --yes/--assume-yes or when stdin is not a terminal, e.g. in
+// cron jobs and CI pipelines.
+func confirmRun(cmd *cobra.Command, message string) (bool, error) {
+	yes, _ := cmd.Flags().GetBool("yes")
+	assumeYes, _ := cmd.Flags().GetBool("assume-yes")
+	if yes || assumeYes {
+		return true, nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintln(os.Stderr, "stdin is not a terminal, continuing without confirmation.")
+		return true, nil
+	}
+
+	confirm := false
+	prompt := &survey.Confirm{
+		Message: message,
+	}
+	err := survey.AskOne(prompt, &confirm, survey.WithStdio(os.Stdin, os.Stderr, os.Stderr))
+	if err != nil {
+		return false, err
+	}
+	if !confirm {
+		fmt.Fprintln(os.Stderr, "Aborted.")
+	}
+	return confirm, nil
+}
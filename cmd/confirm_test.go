@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfirmRun(t *testing.T) {
+	// Replace stdin with a file, which is not a terminal.
+	stdin, err := os.Create(filepath.Join(t.TempDir(), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	saved := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = saved })
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"yes", []string{"--yes"}},
+		{"assume yes", []string{"--assume-yes"}},
+		{"not a terminal", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().BoolP("yes", "y", false, "")
+			cmd.Flags().Bool("assume-yes", false, "")
+			if err := cmd.Flags().Parse(tt.args); err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			confirm, err := confirmRun(cmd, "Do you want to continue?")
+			if err != nil || !confirm {
+				t.Errorf("expected the run to be confirmed without a prompt, got %t, %v", confirm, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// addContextsFlags adds the flags that run a check against several kubeconfig
+// contexts.
+func addContextsFlags(flags *pflag.FlagSet) {
+	flags.Bool("all-contexts", false, "Run against every context of the kubeconfig concurrently, in one table with a CLUSTER column")
+	flags.StringSlice("contexts", nil, "Run against these kubeconfig contexts concurrently, e.g. a,b,c")
+	flags.Int("cluster-concurrency", defaultClusterConcurrency, "Number of contexts scanned in parallel, each with --concurrency nodes in parallel")
+}
+
+// defaultClusterConcurrency is the number of contexts scanned in parallel.
+const defaultClusterConcurrency = 4
+
+// contextsFromFlags returns the contexts selected by the flags added by
+// addContextsFlags, or none to run against the current context.
+func contextsFromFlags(cmd *cobra.Command) ([]string, error) {
+	all, _ := cmd.Flags().GetBool("all-contexts")
+	names, _ := cmd.Flags().GetStringSlice("contexts")
+	if all && len(names) > 0 {
+		return nil, errors.New("--all-contexts and --contexts are mutually exclusive")
+	}
+	if all || len(names) > 0 {
+		// These flags select a single cluster or user, which would be used
+		// in place of the one of every context. Username and Password are
+		// nil unless the deprecated basic authentication flags are added.
+		selected := []struct {
+			flag  string
+			value *string
+		}{
+			{"context", kubeConfigFlags.Context},
+			{"cluster", kubeConfigFlags.ClusterName},
+			{"user", kubeConfigFlags.AuthInfoName},
+			{"server", kubeConfigFlags.APIServer},
+			{"tls-server-name", kubeConfigFlags.TLSServerName},
+			{"certificate-authority", kubeConfigFlags.CAFile},
+			{"client-certificate", kubeConfigFlags.CertFile},
+			{"client-key", kubeConfigFlags.KeyFile},
+			{"token", kubeConfigFlags.BearerToken},
+			{"username", kubeConfigFlags.Username},
+			{"password", kubeConfigFlags.Password},
+		}
+		for _, f := range selected {
+			if f.value != nil && *f.value != "" {
+				return nil, fmt.Errorf("--%s cannot be combined with --all-contexts or --contexts", f.flag)
+			}
+		}
+	}
+
+	if all {
+		config, err := kubeConfigFlags.ToRawKubeConfigLoader().RawConfig()
+		if err != nil {
+			return nil, err
+		}
+		for name := range config.Contexts {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			return nil, errors.New("no contexts found in the kubeconfig")
+		}
+		sort.Strings(names)
+	}
+
+	var contexts []string
+	for _, name := range names {
+		if !slices.Contains(contexts, name) {
+			contexts = append(contexts, name)
+		}
+	}
+	return contexts, nil
+}
+
+// contextConfigFlags returns the kubectl flags of the root command with the
+// context replaced. The flags rejected by contextsFromFlags are left out, so
+// the cluster and user come from the context.
+func contextConfigFlags(name string) *genericclioptions.ConfigFlags {
+	flags := genericclioptions.NewConfigFlags(false)
+	flags.KubeConfig = kubeConfigFlags.KubeConfig
+	flags.CacheDir = kubeConfigFlags.CacheDir
+	flags.Context = &name
+	flags.Namespace = nil
+	flags.Insecure = kubeConfigFlags.Insecure
+	flags.Impersonate = kubeConfigFlags.Impersonate
+	flags.ImpersonateUID = kubeConfigFlags.ImpersonateUID
+	flags.ImpersonateGroup = kubeConfigFlags.ImpersonateGroup
+	flags.Timeout = kubeConfigFlags.Timeout
+	flags.DisableCompression = kubeConfigFlags.DisableCompression
+	return flags
+}
+
+// runContexts runs a check against every context concurrently, at most
+// --cluster-concurrency at a time. A context whose clients cannot be created
+// or whose check fails is reported in the table, the others still run.
+func runContexts(cmd *cobra.Command, def check.Definition, opts check.Options, nodes check.NodeFilter, contexts []string) error {
+	concurrency, _ := cmd.Flags().GetInt("cluster-concurrency")
+	if concurrency <= 0 {
+		return fmt.Errorf("cluster concurrency %d must be positive", concurrency)
+	}
+
+	var clusters []check.Cluster
+	for _, name := range contexts {
+		cluster := check.Cluster{Name: name}
+		env, err := check.NewEnv(contextConfigFlags(name))
+		if err != nil {
+			cluster.Err = err
+		} else {
+			cluster.Check, err = def.New(env, opts, cmd.Flags())
+			if err != nil {
+				return err
+			}
+		}
+		clusters = append(clusters, cluster)
+	}
+
+	confirm, err := confirmRun(cmd, def.Prompt)
+	if err != nil {
+		return err
+	}
+	if !confirm {
+		return nil
+	}
+
+	ctx, stop := scanContext()
+	defer stop()
+	report := check.RunClusters(ctx, clusters, concurrency, nodes)
+	err = check.Render(os.Stdout, opts.Output, report)
+	if err != nil {
+		return fmt.Errorf("failed to print results: %w", err)
+	}
+	return exitWithStatuses(cmd, check.Statuses(report))
+}
@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster: {server: https://prod.example.com}
+- name: staging
+  cluster: {server: https://staging.example.com}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: staging
+  context: {cluster: staging, user: admin}
+- name: prod
+  context: {cluster: prod, user: admin}
+current-context: prod
+`
+
+// newContextsCmd parses args with the kubectl flags of the root command and
+// the flags added by addContextsFlags. The kubectl flags are global, so they
+// are reset once the test is done.
+func newContextsCmd(t *testing.T, args ...string) *cobra.Command {
+	cmd := &cobra.Command{}
+	addKubeConfigFlags(cmd.Flags())
+	addContextsFlags(cmd.Flags())
+	t.Cleanup(func() {
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			if f.Value.Type() == "string" {
+				_ = f.Value.Set(f.DefValue)
+			}
+		})
+	})
+	if err := cmd.Flags().Parse(args); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return cmd
+}
+
+func TestContextsFromFlags(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		err  string
+	}{
+		{name: "current context", args: nil, want: nil},
+		{name: "contexts", args: []string{"--contexts", "staging,prod"}, want: []string{"staging", "prod"}},
+		{name: "duplicate contexts", args: []string{"--contexts", "prod,staging,prod", "--contexts", "staging"}, want: []string{"prod", "staging"}},
+		{name: "all contexts", args: []string{"--all-contexts", "--kubeconfig", filename}, want: []string{"prod", "staging"}},
+		{name: "all and contexts", args: []string{"--all-contexts", "--contexts", "prod"}, err: "--all-contexts and --contexts are mutually exclusive"},
+		{name: "context", args: []string{"--contexts", "prod", "--context", "staging"}, err: "--context cannot be combined with --all-contexts or --contexts"},
+		{name: "cluster", args: []string{"--all-contexts", "--cluster", "prod"}, err: "--cluster cannot be combined with --all-contexts or --contexts"},
+		{name: "user", args: []string{"--contexts", "prod", "--user", "admin"}, err: "--user cannot be combined with --all-contexts or --contexts"},
+		{name: "server", args: []string{"--contexts", "prod", "--server", "https://prod.example.com"}, err: "--server cannot be combined with --all-contexts or --contexts"},
+		{name: "token", args: []string{"--contexts", "prod", "--token", "secret"}, err: "--token cannot be combined with --all-contexts or --contexts"},
+		{name: "client key", args: []string{"--contexts", "prod", "--client-key", "admin.key"}, err: "--client-key cannot be combined with --all-contexts or --contexts"},
+		{name: "single context flags", args: []string{"--context", "staging", "--token", "secret"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contexts, err := contextsFromFlags(newContextsCmd(t, tt.args...))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("contextsFromFlags: %v", err)
+			}
+			if !slices.Equal(contexts, tt.want) {
+				t.Errorf("expected contexts %v, got %v", tt.want, contexts)
+			}
+		})
+	}
+}
+
+func TestContextConfigFlags(t *testing.T) {
+	newContextsCmd(t, "--kubeconfig", "/tmp/config", "--request-timeout", "5s")
+
+	flags := contextConfigFlags("staging")
+	if *flags.Context != "staging" || *flags.KubeConfig != "/tmp/config" || *flags.Timeout != "5s" {
+		t.Errorf("expected the context with the shared flags, got context %s, kubeconfig %s, timeout %s", *flags.Context, *flags.KubeConfig, *flags.Timeout)
+	}
+	if flags.Namespace != nil {
+		t.Error("expected no namespace")
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/doctor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const continuePrompt = "Do you want to continue?"
+
+// newDoctorCmd creates the command running every registered check. It must be
+// created after the checks are registered.
+func newDoctorCmd() *cobra.Command {
+	defs := doctorDefinitions()
+
+	var names, prompts []string
+	for _, def := range defs {
+		names = append(names, def.Name)
+		prompt := strings.TrimSpace(strings.TrimSuffix(def.Prompt, continuePrompt))
+		if prompt != "" {
+			prompts = append(prompts, prompt)
+		}
+	}
+	prompt := strings.Join(append(prompts, continuePrompt), "\n")
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Run every check and report the health of each node",
+		Long: `Run every check (` + strings.Join(names, ", ") + `) in one pass and print a single report
+with a health verdict per node and the remediation hints, most urgent first.
+
+The checks run one after another, and the maps read by the BPF map pressure scan
+are reused by the SNAT eviction check instead of being read again on each node.
+Only the maps are shared: the SNAT eviction check still execs into the
+cilium-agent pods of the nodes whose SNAT map the scan could not read, and the
+inspector pods of the scan are deleted before it starts. A check that fails is
+reported and does not stop the others, an interrupted run skips the remaining
+checks.
+
+Example:
+  # Check the health of all nodes
+  kubectl-cilium doctor
+
+  # Show every finding of every check
+  kubectl-cilium doctor -o wide
+
+  # Print the report as JSON, including the result of each check
+  kubectl-cilium doctor --yes -o json
+
+` + exitCodesHelp,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := checkOptionsFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			nodes, err := nodeFilterFromFlags(cmd)
+			if err != nil {
+				return err
+			}
+			env, err := envFromFlags()
+			if err != nil {
+				return err
+			}
+			env.Maps = check.NewMapCache()
+
+			var checks []doctor.Check
+			for _, def := range defs {
+				c, err := def.New(env, opts, cmd.Flags())
+				if err != nil {
+					return err
+				}
+				checks = append(checks, doctor.Check{Name: def.Name, Check: c})
+			}
+
+			confirm, err := confirmRun(cmd, prompt)
+			if err != nil {
+				return err
+			}
+			if !confirm {
+				return nil
+			}
+
+			ctx, stop := scanContext()
+			defer stop()
+			report, err := check.Run(ctx, doctor.New(checks), nodes, os.Stdout, opts.Output)
+			if err != nil {
+				return err
+			}
+			return exitWithStatuses(cmd, check.Statuses(report))
+		},
+	}
+
+	// The checks may share flags, e.g. the pressure flags, which are added once.
+	for _, def := range defs {
+		if def.AddFlags == nil {
+			continue
+		}
+		flags := pflag.NewFlagSet(def.Name, pflag.ContinueOnError)
+		def.AddFlags(flags)
+		cmd.Flags().AddFlagSet(flags)
+	}
+	return cmd
+}
+
+// doctorDefinitions returns the registered checks in the order the doctor
+// runs them, those storing the maps they read first.
+func doctorDefinitions() []check.Definition {
+	defs := check.Definitions()
+	sort.SliceStable(defs, func(i, j int) bool {
+		return defs[i].StoresMaps && !defs[j].StoresMaps
+	})
+	return defs
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the scan commands, so that CI can gate on map pressure.
+const (
+	exitOK         = 0
+	exitError      = 1
+	exitWarning    = 2
+	exitIncomplete = 3
+	exitCritical   = 4
+)
+
+const exitCodesHelp = `Exit codes:
+  0  all scanned maps are OK
+  1  the scan could not be run
+  2  at least one map is above the warning threshold, none above the critical one
+  3  no warnings, but some nodes or maps could not be scanned (Unknown)
+  4  at least one map is above the critical threshold
+`
+
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit code %d", e.code)
+}
+
+// scanExitCode maps the statuses of a scan result to an exit code. Critical
+// takes precedence over Warning, and both over an incomplete scan.
+func scanExitCode(statuses []check.Status) int {
+	code := exitOK
+	for _, status := range statuses {
+		switch status {
+		case check.Critical:
+			return exitCritical
+		case check.Warning:
+			code = exitWarning
+		case check.Unknown:
+			if code == exitOK {
+				code = exitIncomplete
+			}
+		}
+	}
+	return code
+}
+
+// exitWithStatuses returns an error carrying the exit code of a finished scan,
+// or nil if everything is OK.
+func exitWithStatuses(cmd *cobra.Command, statuses []check.Status) error {
+	code := scanExitCode(statuses)
+	if code == exitOK {
+		return nil
+	}
+	cmd.SilenceUsage = true
+	return &exitCodeError{code: code}
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/spf13/cobra"
+)
+
+func TestScanExitCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []check.Status
+		want     int
+	}{
+		{"empty", nil, exitOK},
+		{"ok", []check.Status{check.OK, check.OK}, exitOK},
+		{"warning", []check.Status{check.OK, check.Warning}, exitWarning},
+		{"critical", []check.Status{check.Critical}, exitCritical},
+		{"unknown", []check.Status{check.OK, check.Unknown}, exitIncomplete},
+		{"warning and unknown", []check.Status{check.Unknown, check.Warning, check.OK}, exitWarning},
+		{"unknown after warning", []check.Status{check.Warning, check.Unknown}, exitWarning},
+		{"critical and warning", []check.Status{check.Warning, check.Critical, check.Unknown}, exitCritical},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanExitCode(tt.statuses); got != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExitWithStatuses(t *testing.T) {
+	cmd := &cobra.Command{}
+	if err := exitWithStatuses(cmd, []check.Status{check.OK}); err != nil {
+		t.Errorf("expected no error for an OK scan, got %v", err)
+	}
+
+	err := exitWithStatuses(cmd, []check.Status{check.OK, check.Unknown})
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != exitIncomplete {
+		t.Errorf("expected exit code %d, got %v", exitIncomplete, err)
+	}
+	if !cmd.SilenceUsage {
+		t.Error("expected the usage to be silenced")
+	}
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// addInspectorFlags adds the flags that configure the inspector pods and
+// ephemeral containers, e.g. to pull the image from a private registry.
+func addInspectorFlags(flags *pflag.FlagSet) {
+	flags.String("inspector-config", "", "YAML file with the image, pull secrets, resources, priority class, tolerations and node selector of the inspector pods")
+	flags.String("inspector-image", "", "Image with bpftool, and optionally bpf-map-count, for the inspector pods and ephemeral containers (default "+pressure.DefaultInspector().Image+")")
+	flags.String("inspector-image-pull-policy", "", "Pull policy of the inspector image (Always, IfNotPresent or Never)")
+	flags.StringArray("inspector-image-pull-secret", nil, "Secret to pull the inspector image with as [namespace/]name, copied into the inspector namespace (default namespace kube-system, repeatable)")
+	flags.String("inspector-cpu-request", "", "CPU request of the inspector pods (default 0)")
+	flags.String("inspector-cpu-limit", "", "CPU limit of the inspector pods (default 200m)")
+	flags.String("inspector-memory-request", "", "Memory request of the inspector pods")
+	flags.String("inspector-memory-limit", "", "Memory limit of the inspector pods")
+	flags.String("inspector-priority-class", "", "Priority class of the inspector pods")
+	flags.StringArray("inspector-toleration", nil, "Toleration of the inspector pods as key[=value][:effect], replacing the default toleration of all taints (repeatable)")
+	flags.StringToString("inspector-node-selector", nil, "Node selector of the inspector pods, nodes it does not match fail to be inspected")
+}
+
+// inspectorFromFlags loads --inspector-config and applies the other flags
+// added by addInspectorFlags on top of it when they are set explicitly.
+func inspectorFromFlags(flags *pflag.FlagSet) (pressure.Inspector, error) {
+	inspector := pressure.DefaultInspector()
+
+	filename, _ := flags.GetString("inspector-config")
+	if filename != "" {
+		var err error
+		inspector, err = pressure.LoadInspectorFile(filename)
+		if err != nil {
+			return pressure.Inspector{}, err
+		}
+	}
+
+	if flags.Changed("inspector-image") {
+		inspector.Image, _ = flags.GetString("inspector-image")
+	}
+	if flags.Changed("inspector-image-pull-policy") {
+		policy, _ := flags.GetString("inspector-image-pull-policy")
+		inspector.ImagePullPolicy = corev1.PullPolicy(policy)
+	}
+	if flags.Changed("inspector-image-pull-secret") {
+		inspector.ImagePullSecrets, _ = flags.GetStringArray("inspector-image-pull-secret")
+	}
+	if flags.Changed("inspector-priority-class") {
+		inspector.PriorityClassName, _ = flags.GetString("inspector-priority-class")
+	}
+	if flags.Changed("inspector-node-selector") {
+		inspector.NodeSelector, _ = flags.GetStringToString("inspector-node-selector")
+	}
+
+	resources := []struct {
+		flag string
+		list *corev1.ResourceList
+		name corev1.ResourceName
+	}{
+		{"inspector-cpu-request", &inspector.Resources.Requests, corev1.ResourceCPU},
+		{"inspector-cpu-limit", &inspector.Resources.Limits, corev1.ResourceCPU},
+		{"inspector-memory-request", &inspector.Resources.Requests, corev1.ResourceMemory},
+		{"inspector-memory-limit", &inspector.Resources.Limits, corev1.ResourceMemory},
+	}
+	for _, r := range resources {
+		if !flags.Changed(r.flag) {
+			continue
+		}
+		value, _ := flags.GetString(r.flag)
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return pressure.Inspector{}, fmt.Errorf("invalid --%s %q: %w", r.flag, value, err)
+		}
+		if *r.list == nil {
+			*r.list = corev1.ResourceList{}
+		}
+		(*r.list)[r.name] = quantity
+	}
+
+	tolerations, _ := flags.GetStringArray("inspector-toleration")
+	for _, s := range tolerations {
+		toleration, err := pressure.ParseToleration(s)
+		if err != nil {
+			return pressure.Inspector{}, err
+		}
+		inspector.Tolerations = append(inspector.Tolerations, toleration)
+	}
+
+	return inspector, inspector.Validate()
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+	"github.com/spf13/pflag"
+)
+
+// addMapFlags adds the flags that select the maps inspected by the pressure scanner.
+func addMapFlags(flags *pflag.FlagSet) {
+	flags.StringArray("map", nil, "Shell pattern of the pinned maps to inspect instead of the built-in list, e.g. 'cilium_lb4_*' (repeatable)")
+	flags.Bool("all-maps", false, "Inspect every map pinned under /sys/fs/bpf/tc/globals, except preallocated arrays")
+	flags.Bool("policy-maps", false, "Also check the per-endpoint policy maps against bpf-policy-map-max")
+}
+
+// applyMapFlags sets the map selection of opts from the flags added by addMapFlags.
+func applyMapFlags(flags *pflag.FlagSet, opts *pressure.Options) {
+	opts.MapPatterns, _ = flags.GetStringArray("map")
+	opts.AllMaps, _ = flags.GetBool("all-maps")
+	opts.PolicyMaps, _ = flags.GetBool("policy-maps")
+}
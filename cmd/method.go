@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+	"github.com/spf13/pflag"
+)
+
+// addBackendFlags adds the flags that select where and how the pressure
+// scanner inspects the maps.
+func addBackendFlags(flags *pflag.FlagSet) {
+	flags.String("method", string(pressure.MethodAuto),
+		"Where to run bpftool: agent-exec (in the cilium-agent containers), inspector-pod, ephemeral-container, "+
+			"or auto to use agent-exec, with cilium-dbg when the agent image has no bpftool, and inspector-pod only when bpftool is required by --source")
+	flags.String("source", string(pressure.SourceAuto),
+		"How to inspect the maps: bpftool, cilium-dbg (map pressure reported by cilium-agent, implies agent-exec), "+
+			"metrics (bpf_map_pressure scraped from the cilium-agent metrics, bpftool for the maps it does not cover), "+
+			"or auto to use cilium-dbg only with the auto or agent-exec method when the agent image has no bpftool")
+}
+
+// backendFromFlags parses the flags added by addBackendFlags.
+func backendFromFlags(flags *pflag.FlagSet) (pressure.Method, pressure.Source, error) {
+	methodFlag, _ := flags.GetString("method")
+	method, err := pressure.ParseMethod(methodFlag)
+	if err != nil {
+		return "", "", err
+	}
+	sourceFlag, _ := flags.GetString("source")
+	source, err := pressure.ParseSource(sourceFlag)
+	if err != nil {
+		return "", "", err
+	}
+	return method, source, nil
+}
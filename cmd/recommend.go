@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"context"
+	"os"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/recommend"
+
+	"github.com/spf13/cobra"
+)
+
+var recommendCmd = &cobra.Command{
+	Use:   "recommend",
+	Short: "Recommend BPF map sizing across all nodes",
+	Long: `Scan the core BPF maps of all nodes like bpf-map-pressure and compute the minimum
+bpf-map-dynamic-size-ratio, or static bpf-*-max values, that keeps every map under
+the target usage with headroom for growth.
+
+It also estimates the extra kernel memory each node would need for the maps
+from their key and value sizes.
+
+Example:
+  # Keep every map under 70% usage with 20% headroom
+  kubectl-cilium recommend
+
+  # Keep every map under 60% usage with 50% headroom
+  kubectl-cilium recommend --target-usage=0.6 --headroom=0.5
+
+  # Print the recommendation as JSON for other tools
+  kubectl-cilium recommend --yes -o json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		checkOpts, err := checkOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		nodes, err := nodeFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		targetUsage, _ := cmd.Flags().GetFloat64("target-usage")
+		headroom, _ := cmd.Flags().GetFloat64("headroom")
+		opts := recommend.Options{TargetUsage: targetUsage, Headroom: headroom}
+		err = opts.Validate()
+		if err != nil {
+			return err
+		}
+
+		env, err := envFromFlags()
+		if err != nil {
+			return err
+		}
+		s, err := newPressureScanner(env, checkOpts, cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		confirm, err := confirmRun(cmd, `This command runs bpftool on all nodes, in the cilium-agent containers or in inspector pods (see --method), to check BPF map sizes. And it may consume CPU resource (200m core limit by default, see --inspector-cpu-limit)
+Do you want to continue?`)
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+
+		err = s.Collect(context.Background(), nodes)
+		if err != nil {
+			return err
+		}
+
+		return recommend.Print(os.Stdout, checkOpts.Output, recommend.Compute(s.Result(), opts))
+	},
+}
+
+func init() {
+	recommendCmd.Flags().Float64("target-usage", recommend.DefaultTargetUsage, "Usage ratio (0-1] every map should stay below")
+	recommendCmd.Flags().Float64("headroom", recommend.DefaultHeadroom, "Growth of the current entries to plan for, e.g. 0.2 for 20%")
+	addPressureFlags(recommendCmd.Flags())
+	rootCmd.AddCommand(recommendCmd)
+}
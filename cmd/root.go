@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/threshold"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
 )
 
 var rootCmd = &cobra.Command{
@@ -11,18 +21,65 @@ var rootCmd = &cobra.Command{
 	Annotations: map[string]string{
 		cobra.CommandDisplayNameAnnotation: "kubectl cilium",
 	},
-	Short: "Diagnostic tool for Cilium",
-	Long:  `Diagnostic tool for Cilium`,
+	Short:         "Diagnostic tool for Cilium",
+	Long:          `Diagnostic tool for Cilium`,
+	SilenceErrors: true,
 }
 
+// kubeConfigFlags are the kubeconfig, context and credentials flags of
+// kubectl. The namespace flag is left out, Cilium's namespace is fixed and -n
+// selects the node.
+var kubeConfigFlags = func() *genericclioptions.ConfigFlags {
+	flags := genericclioptions.NewConfigFlags(true)
+	flags.Namespace = nil
+	return flags
+}()
+
 func Execute() {
+	// doctor runs the registered checks, so it is added once they all are.
+	rootCmd.AddCommand(newDoctorCmd())
+
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(exitError)
 	}
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringP("kubeconfig", "k", "", "Path to kubeconfig file")
-	rootCmd.PersistentFlags().StringP("nodename", "n", "", "Node name")
+	addKubeConfigFlags(rootCmd.PersistentFlags())
+	rootCmd.PersistentFlags().StringSliceP("nodename", "n", nil, "Name of the node to inspect, repeatable or comma-separated")
+	rootCmd.PersistentFlags().StringP("selector", "l", "", "Label selector of the nodes to inspect, e.g. a node pool")
+	rootCmd.PersistentFlags().String("node-pattern", "", "Regular expression the names of the nodes to inspect must match")
+	rootCmd.PersistentFlags().Bool("exclude-unschedulable", false, "Skip the cordoned nodes")
+	rootCmd.PersistentFlags().Bool("only-ready", false, "Skip the nodes that are not Ready")
+	rootCmd.PersistentFlags().Int("sample", 0, "Inspect a random subset of this many of the selected nodes")
+	rootCmd.PersistentFlags().BoolP("yes", "y", false, "Do not ask for confirmation before scanning")
+	rootCmd.PersistentFlags().Bool("assume-yes", false, "Alias of --yes")
+	rootCmd.PersistentFlags().Float64("warning-threshold", threshold.DefaultWarning, "Usage ratio (0-1] from which a map is reported as Warning")
+	rootCmd.PersistentFlags().Float64("critical-threshold", threshold.DefaultCritical, "Usage ratio (0-1] from which a map is reported as Critical")
+	rootCmd.PersistentFlags().String("threshold-file", "", "YAML file with global and per-map warning/critical thresholds")
+	rootCmd.PersistentFlags().StringP("output", "o", string(output.Table), "Output format ("+output.FormatNames()+")")
+	rootCmd.PersistentFlags().Int("concurrency", check.DefaultConcurrency, "Number of nodes inspected in parallel")
+}
+
+// scanContext returns the context of a scan, cancelled by the first SIGINT or
+// SIGTERM so that the scans clean up their inspector pods and containers. It
+// is shared by every scan of the process, and the later signals are ignored
+// until stop is called, so that they do not interrupt the cleanup.
+func scanContext() (ctx context.Context, stop context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// addKubeConfigFlags adds the flags of kubeConfigFlags, keeping -k as the
+// shorthand of --kubeconfig.
+func addKubeConfigFlags(flags *pflag.FlagSet) {
+	kubeFlags := pflag.NewFlagSet("kubectl", pflag.ContinueOnError)
+	kubeConfigFlags.AddFlags(kubeFlags)
+	kubeFlags.Lookup("kubeconfig").Shorthand = "k"
+	flags.AddFlagSet(kubeFlags)
 }
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/exporter"
+
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Export BPF map pressure as Prometheus metrics",
+	Long: `Scan the core BPF maps of all nodes like bpf-map-pressure on a schedule and serve the result
+as Prometheus metrics on /metrics.
+
+The inspector pods are kept between scans and cleaned up on exit. The following metrics
+are labeled by node and map:
+  kubectl_cilium_bpf_map_entries            entries in the map
+  kubectl_cilium_bpf_map_max_entries        maximum entries of the map
+  kubectl_cilium_bpf_map_usage_ratio        entries / maximum entries
+  kubectl_cilium_bpf_map_scan_errors_total  scans that failed to read the map
+
+Example:
+  # Serve the metrics on :9090 and re-scan every 5 minutes
+  kubectl-cilium serve --yes --listen=:9090 --interval=5m
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		listen, _ := cmd.Flags().GetString("listen")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			return fmt.Errorf("interval %s must be positive", interval)
+		}
+
+		checkOpts, err := checkOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		nodes, err := nodeFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		env, err := envFromFlags()
+		if err != nil {
+			return err
+		}
+		s, err := newPressureScanner(env, checkOpts, cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		confirm, err := confirmRun(cmd, `This command keeps inspector pods on all nodes to check BPF map pressure. And it may consume CPU resource (200m core limit by default, see --inspector-cpu-limit)
+Do you want to continue?`)
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+
+		ctx, stop := scanContext()
+		defer stop()
+		session, err := s.Open(ctx, nodes)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		return exporter.Serve(session, listen, interval)
+	},
+}
+
+func init() {
+	serveCmd.Flags().String("listen", ":9090", "Address to serve the metrics on")
+	serveCmd.Flags().Duration("interval", 5*time.Minute, "Time between scans")
+	addPressureFlags(serveCmd.Flags())
+	rootCmd.AddCommand(serveCmd)
+}
@@ -1,17 +1,16 @@
 package cmd
 
 import (
-	"fmt"
-	"github.com/AlecAivazis/survey/v2"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
 	"github.com/gyutaeb/kubectl-cilium/internal/scanner"
-	"github.com/spf13/cobra"
-	"os"
+	"github.com/spf13/pflag"
 )
 
-var snatEvicitonCmd = &cobra.Command{
-	Use:   "snat-eviction",
-	Short: "Detect nodes at risk of SNAT map eviction",
-	Long: `Analyze cluster nodes to identify those at risk of SNAT map eviction issue.
+func init() {
+	registerCheck(check.Definition{
+		Name:  "snat-eviction",
+		Short: "Detect nodes at risk of SNAT map eviction",
+		Long: `Analyze cluster nodes to identify those at risk of SNAT map eviction issue.
 
 This command checks for conditions that could lead to SNAT map high eviction rates,
 such as a large number of active connections. If any nodes are identified as being at risk,
@@ -22,35 +21,24 @@ For more details, please refer to: https://github.com/cilium/cilium/pull/37747
 Examples:
   # Check for SNAT eviction risks across all nodes
   kubectl-cilium snat-eviction
-`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		confirm := false
-		prompt := &survey.Confirm{
-			Message: "Do you want to continue?",
-		}
-		err := survey.AskOne(prompt, &confirm)
-		if err != nil {
-			return err
-		}
-		if !confirm {
-			fmt.Println("Aborted.")
-			os.Exit(0)
-		}
-
-		kubeconfig, _ := cmd.Flags().GetString("kubeconfig")
-		nodeName, _ := cmd.Flags().GetString("nodename")
-		s, err := scanner.NewScanner(nil, nil, kubeconfig)
-		if err != nil {
-			return err
-		}
-		err = s.Validate()
-		if err != nil {
-			return err
-		}
-		return s.Run(nodeName)
-	},
-}
 
-func init() {
-	rootCmd.AddCommand(snatEvicitonCmd)
+  # Print the result as YAML for other tools
+  kubectl-cilium snat-eviction -o yaml
+
+  # Warn from 70% and report Critical from 85%
+  kubectl-cilium snat-eviction --warning-threshold=0.7 --critical-threshold=0.85
+
+  # Run without the confirmation prompt, e.g. in a CI pipeline
+  kubectl-cilium snat-eviction --yes -o json
+
+` + exitCodesHelp,
+		Prompt: "Do you want to continue?",
+		New: func(env *check.Env, opts check.Options, flags *pflag.FlagSet) (check.Check, error) {
+			s, err := scanner.NewScanner(env, scanner.Options{Options: opts})
+			if err != nil {
+				return nil, err
+			}
+			return s, s.Validate()
+		},
+	})
 }
@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/gyutaeb/kubectl-cilium/internal/threshold"
+	"github.com/spf13/cobra"
+)
+
+// thresholdsFromFlags loads --threshold-file and applies --warning-threshold
+// and --critical-threshold on top of it when they are set explicitly.
+func thresholdsFromFlags(cmd *cobra.Command) (*threshold.Config, error) {
+	thresholds := threshold.Default()
+
+	filename, _ := cmd.Flags().GetString("threshold-file")
+	if filename != "" {
+		var err error
+		thresholds, err = threshold.LoadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cmd.Flags().Changed("warning-threshold") {
+		thresholds.Warning, _ = cmd.Flags().GetFloat64("warning-threshold")
+	}
+	if cmd.Flags().Changed("critical-threshold") {
+		thresholds.Critical, _ = cmd.Flags().GetFloat64("critical-threshold")
+	}
+
+	return thresholds, thresholds.Validate()
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/tui"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse BPF map pressure interactively",
+	Long: `Scan the core BPF maps of all nodes like bpf-map-pressure and browse the result in the terminal.
+
+Nodes are listed by the usage of their worst map. Open a node to see all of its
+maps and open a map to see a sample of its entries. The inspector pods are kept
+until the UI is closed, so that the maps can be re-scanned and sampled.
+
+Keys:
+  up/down, j/k        move the selection
+  enter, right, l     open the selected node or map
+  esc, left, h        go back
+  /                   filter maps by name
+  f                   filter nodes by label selector, e.g. topology.kubernetes.io/zone=a
+  r                   re-scan all nodes
+  q, ctrl-c           quit
+
+Example:
+  # Browse the BPF map pressure of all nodes
+  kubectl-cilium tui
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+			return errors.New("tui needs a terminal, use bpf-map-pressure -o json instead")
+		}
+
+		checkOpts, err := checkOptionsFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		nodes, err := nodeFilterFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		env, err := envFromFlags()
+		if err != nil {
+			return err
+		}
+		s, err := newPressureScanner(env, checkOpts, cmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		confirm, err := confirmRun(cmd, `This command runs bpftool on all nodes, in the cilium-agent containers or in inspector pods (see --method), to check BPF map pressure. And it may consume CPU resource (200m core limit by default, see --inspector-cpu-limit)
+Do you want to continue?`)
+		if err != nil {
+			return err
+		}
+		if !confirm {
+			return nil
+		}
+
+		ctx, stop := scanContext()
+		defer stop()
+		session, err := s.Open(ctx, nodes)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		return tui.Run(session, os.Stdin, os.Stdout)
+	},
+}
+
+func init() {
+	addPressureFlags(tuiCmd.Flags())
+	rootCmd.AddCommand(tuiCmd)
+}
@@ -0,0 +1,124 @@
+// Package agentmetrics reads the BPF map pressure cilium-agent exports on
+// its metrics endpoint.
+package agentmetrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PressureMetric is the ratio of the entries of a map to its size. The agent
+// only exports it for the maps it tracks, and for policy maps only once they
+// are more than 10% full.
+const PressureMetric = "cilium_bpf_map_pressure"
+
+// DefaultPort is the port of prometheus-serve-addr when metrics are enabled.
+const DefaultPort = "9962"
+
+// MapName returns the pinned map of a map_name label, from which the agent
+// drops the cilium_ prefix.
+func MapName(label string) string {
+	if strings.HasPrefix(label, "cilium_") {
+		return label
+	}
+	return "cilium_" + label
+}
+
+// Scrape reads the metrics of a cilium-agent pod through the pod proxy of the
+// API server.
+func Scrape(ctx context.Context, kc kubernetes.Interface, pod *corev1.Pod, port string) (string, error) {
+	out, err := kc.CoreV1().Pods(pod.Namespace).ProxyGet("http", pod.Name, port, "/metrics", nil).DoRaw(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to scrape metrics of pod %s: %w", pod.Name, err)
+	}
+	return string(out), nil
+}
+
+// ParsePressure returns the pressure of every map in metrics in the Prometheus
+// text format, by pinned map name.
+func ParsePressure(metrics string) (map[string]float64, error) {
+	pressure := map[string]float64{}
+	for _, line := range strings.Split(metrics, "\n") {
+		line = strings.TrimSpace(line)
+		rest, ok := strings.CutPrefix(line, PressureMetric)
+		if !ok || rest == "" || (rest[0] != '{' && rest[0] != ' ') {
+			continue
+		}
+
+		labels, value, err := parseSample(rest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %w", line, err)
+		}
+		if labels["map_name"] != "" {
+			pressure[MapName(labels["map_name"])] = value
+		}
+	}
+	return pressure, nil
+}
+
+// parseSample parses the labels and value that follow the metric name of a
+// sample, e.g. `{map_name="ct4_global"} 0.5 1700000000000`.
+func parseSample(s string) (map[string]string, float64, error) {
+	labels := map[string]string{}
+	if strings.HasPrefix(s, "{") {
+		s = s[1:]
+		for {
+			s = strings.TrimLeft(s, " ,")
+			if rest, ok := strings.CutPrefix(s, "}"); ok {
+				s = rest
+				break
+			}
+			name, rest, ok := strings.Cut(s, "=")
+			rest = strings.TrimLeft(rest, " ")
+			if !ok || !strings.HasPrefix(rest, `"`) {
+				return nil, 0, fmt.Errorf("malformed labels")
+			}
+			value, rest, err := parseQuoted(rest[1:])
+			if err != nil {
+				return nil, 0, err
+			}
+			labels[strings.TrimSpace(name)] = value
+			s = rest
+		}
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return nil, 0, fmt.Errorf("missing value")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, 0, err
+	}
+	return labels, value, nil
+}
+
+// parseQuoted returns the label value up to the closing quote and the rest.
+func parseQuoted(s string) (string, string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			i++
+			if i == len(s) {
+				return "", "", fmt.Errorf("unterminated label value")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated label value")
+}
@@ -0,0 +1,39 @@
+package agentmetrics
+
+import (
+	"testing"
+)
+
+func TestParsePressure(t *testing.T) {
+	metrics := `# HELP cilium_bpf_map_pressure Fill percentage of map, tagged by map name
+# TYPE cilium_bpf_map_pressure gauge
+cilium_bpf_map_pressure{map_name="ct4_global"} 0.85
+cilium_bpf_map_pressure{map_name="snat_v4_external"} 0.01 1700000000000
+cilium_bpf_map_pressure{ map_name = "policy_00042" , extra="a\"}b"} 1e-1
+cilium_bpf_map_pressure_total 3
+cilium_bpf_map_ops_total{map_name="ct4_global",operation="update",outcome="success"} 42
+`
+	pressure, err := ParsePressure(metrics)
+	if err != nil {
+		t.Fatalf("ParsePressure: %v", err)
+	}
+	want := map[string]float64{"cilium_ct4_global": 0.85, "cilium_snat_v4_external": 0.01, "cilium_policy_00042": 0.1}
+	if len(pressure) != len(want) {
+		t.Fatalf("expected %v, got %v", want, pressure)
+	}
+	for name, value := range want {
+		if pressure[name] != value {
+			t.Errorf("%s: expected %g, got %g", name, value, pressure[name])
+		}
+	}
+
+	for _, metrics := range []string{
+		`cilium_bpf_map_pressure{map_name="ct4_global} 0.85`,
+		`cilium_bpf_map_pressure{map_name="ct4_global"}`,
+		`cilium_bpf_map_pressure{map_name="ct4_global"} high`,
+	} {
+		if _, err := ParsePressure(metrics); err == nil {
+			t.Errorf("expected an error for %q", metrics)
+		}
+	}
+}
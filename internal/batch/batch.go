@@ -0,0 +1,194 @@
+// Package batch inspects all pinned maps of a node with a single exec into
+// the inspector pod, instead of one exec per map and command.
+//
+// The script prints one JSON document per line and map:
+//
+//	{"map":"cilium_ct4_global","method":"helper","show":{...},"count":{"entries":1,"max_entries":2},"nanos":12345}
+//
+// where show is the output of `bpftool -j map show` and count is the output
+// of the bpf-map-count helper, or of `bpftool -j map dump` when the helper is
+// not installed or fails. nanos is omitted when date does not support %N.
+package batch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+)
+
+const (
+	MethodHelper = "helper"
+	MethodDump   = "dump"
+)
+
+// script is run with the directory and the shell patterns of the maps as
+// positional parameters, followed by -- and the names of the maps to skip.
+// Newlines are stripped from the dump, so that every map stays on its own line.
+const script = `dir=$1
+shift
+helper=
+command -v ` + bpfcount.HelperName + ` >/dev/null 2>&1 && helper=1
+for p in "$dir"/*; do
+	[ -f "$p" ] || continue
+	name=${p##*/}
+	selected=
+	skip=
+	for arg in "$@"; do
+		if [ "$arg" = -- ]; then
+			skip=1
+		elif [ -n "$skip" ]; then
+			[ "$name" != "$arg" ] || selected=
+		else
+			case $name in $arg) selected=1 ;; esac
+		fi
+	done
+	[ -n "$selected" ] || continue
+	start=$(date +%s%N 2>/dev/null)
+	show=$(bpftool -j map show pinned "$p" 2>/dev/null)
+	[ -n "$show" ] || show=null
+	count=
+	[ -z "$helper" ] || count=$(` + bpfcount.HelperName + ` "$p" 2>/dev/null) || count=
+	if [ -n "$count" ]; then
+		printf '{"map":"%s","method":"helper","show":%s,"count":%s' "$name" "$show" "$count"
+	else
+		printf '{"map":"%s","method":"dump","show":%s,"count":' "$name" "$show"
+		bpftool -j map dump pinned "$p" 2>/dev/null | tr -d '\n'
+	fi
+	end=$(date +%s%N 2>/dev/null)
+	case $start$end in
+	'' | *[!0-9]*) ;;
+	*) printf ',"nanos":%s' $((end - start)) ;;
+	esac
+	printf '}\n'
+done
+`
+
+// Cmd returns the command that inspects the maps pinned in dir whose name
+// matches one of the patterns, except for the excluded maps. Patterns use the
+// syntax of path.Match.
+func Cmd(dir string, patterns []string, excluded ...string) []string {
+	cmd := []string{"sh", "-c", script, "sh", dir}
+	for _, pattern := range patterns {
+		cmd = append(cmd, strings.ReplaceAll(pattern, "[^", "[!"))
+	}
+	if len(excluded) > 0 {
+		cmd = append(cmd, "--")
+		cmd = append(cmd, excluded...)
+	}
+	return cmd
+}
+
+// Stats is the outcome of inspecting a single map.
+type Stats struct {
+	Map      string
+	Info     *bpftool.MapInfo
+	Entries  int
+	Method   string
+	Duration time.Duration
+	// Err is set if the map could not be inspected. Map is empty if even
+	// its name could not be decoded.
+	Err error
+}
+
+// Parse decodes the output of Cmd. A malformed line only affects its own map.
+func Parse(out string) []Stats {
+	var stats []Stats
+	for _, line := range strings.Split(out, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		stats = append(stats, parseLine(line))
+	}
+	return stats
+}
+
+func parseLine(line string) Stats {
+	st := Stats{}
+	malformed := func(err error) Stats {
+		st.Err = fmt.Errorf("failed to decode batch output: %w", err)
+		return st
+	}
+
+	dec := json.NewDecoder(strings.NewReader(line))
+	tok, err := dec.Token()
+	if err != nil {
+		return malformed(err)
+	}
+	if tok != json.Delim('{') {
+		return malformed(fmt.Errorf("unexpected %v", tok))
+	}
+
+	var showErr, countErr error
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return malformed(err)
+		}
+
+		switch tok {
+		case "map":
+			err = dec.Decode(&st.Map)
+		case "method":
+			err = dec.Decode(&st.Method)
+		case "nanos":
+			var nanos int64
+			err = dec.Decode(&nanos)
+			st.Duration = time.Duration(nanos)
+		case "show":
+			var raw json.RawMessage
+			err = dec.Decode(&raw)
+			if err == nil {
+				st.Info, showErr = parseShow(raw)
+			}
+		case "count":
+			if st.Method == MethodHelper {
+				var raw json.RawMessage
+				err = dec.Decode(&raw)
+				if err == nil {
+					var count *bpfcount.Count
+					count, countErr = bpfcount.Parse(string(raw))
+					if countErr == nil {
+						st.Entries = count.Entries
+					}
+				}
+				break
+			}
+			st.Entries, countErr = bpftool.CountDecoded(dec)
+			if countErr != nil {
+				/* The decoder is somewhere inside the dump */
+				return st.withErr(showErr, countErr)
+			}
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return malformed(err)
+		}
+	}
+	return st.withErr(showErr, countErr)
+}
+
+func (st Stats) withErr(showErr, countErr error) Stats {
+	switch {
+	case st.Map == "":
+		st.Err = errors.New("batch output has no map name")
+	case showErr != nil:
+		st.Err = showErr
+	case countErr != nil:
+		st.Err = countErr
+	}
+	return st
+}
+
+func parseShow(raw json.RawMessage) (*bpftool.MapInfo, error) {
+	if string(raw) == "null" {
+		return nil, errors.New("bpftool map show printed nothing")
+	}
+	return bpftool.ParseMapShow(string(raw))
+}
@@ -0,0 +1,111 @@
+package batch
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const show = `{"id":7,"type":"lru_hash","name":"cilium_ct4_glob","flags":0,"bytes_key":14,"bytes_value":56,"max_entries":1000,"bytes_memlock":4096}`
+
+func TestParse(t *testing.T) {
+	out := `{"map":"cilium_ct4_global","method":"helper","show":` + show + `,"count":{"entries":900,"max_entries":1000},"nanos":2000000}
+{"map":"cilium_ct_any4_global","method":"dump","show":` + show + `,"count":[{"key":["0x00"],"value":["0x00"]},{"key":["0x01"],"value":["0x00"]}]}
+{"map":"cilium_snat_v4_external","method":"dump","show":` + show + `,"count":{"error":"can't lock map"}}
+{"map":"cilium_lb4_services_v2","method":"dump","show":null,"count":[]}
+Error: bpf obj get
+{"map":"cilium_ipcache","method":"dump","show":` + show + `,"count":[{"key":
+`
+	stats := Parse(out)
+	if len(stats) != 6 {
+		t.Fatalf("expected 6 maps, got %+v", stats)
+	}
+
+	if ct := stats[0]; ct.Err != nil || ct.Map != "cilium_ct4_global" || ct.Method != MethodHelper || ct.Entries != 900 || ct.Info.MaxEntries != 1000 || ct.Duration.Milliseconds() != 2 {
+		t.Errorf("unexpected helper stats %+v", ct)
+	}
+	if ctAny := stats[1]; ctAny.Err != nil || ctAny.Method != MethodDump || ctAny.Entries != 2 || ctAny.Duration != 0 {
+		t.Errorf("unexpected dump stats %+v", ctAny)
+	}
+	if snat := stats[2]; snat.Map != "cilium_snat_v4_external" || snat.Err == nil || !strings.Contains(snat.Err.Error(), "can't lock map") {
+		t.Errorf("expected the bpftool error, got %+v", snat)
+	}
+	if lb := stats[3]; lb.Map != "cilium_lb4_services_v2" || lb.Err == nil {
+		t.Errorf("expected an error without map show output, got %+v", lb)
+	}
+	if garbage := stats[4]; garbage.Map != "" || garbage.Err == nil {
+		t.Errorf("expected an error without map name, got %+v", garbage)
+	}
+	if ipcache := stats[5]; ipcache.Map != "cilium_ipcache" || ipcache.Err == nil {
+		t.Errorf("expected an error for a truncated dump, got %+v", ipcache)
+	}
+}
+
+func TestCmd(t *testing.T) {
+	cmd := Cmd("/sys/fs/bpf/tc/globals", []string{"cilium_ct*", "cilium_[^c]*"})
+	if !slices.Equal(cmd[3:], []string{"sh", "/sys/fs/bpf/tc/globals", "cilium_ct*", "cilium_[!c]*"}) {
+		t.Errorf("unexpected arguments %q", cmd[3:])
+	}
+}
+
+// TestScript runs the script against a fake bpftool.
+func TestScript(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir := t.TempDir()
+	globals := filepath.Join(dir, "globals")
+	bin := filepath.Join(dir, "bin")
+	for _, d := range []string{globals, bin, filepath.Join(globals, "cilium_ct_dir")} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"cilium_ct4_global", "cilium_ipcache", "cilium_lxc"} {
+		if err := os.WriteFile(filepath.Join(globals, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bpftool := `#!/bin/sh
+case $3 in
+show) echo '` + show + `' ;;
+dump) printf '[{"key":["0x00"],\n"value":["0x00"]}\n]\n' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(bin, "bpftool"), []byte(bpftool), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		excluded []string
+		want     []string
+	}{
+		{want: []string{"cilium_ct4_global", "cilium_ipcache"}},
+		{excluded: []string{"cilium_ipcache"}, want: []string{"cilium_ct4_global"}},
+	}
+	for _, tt := range tests {
+		cmd := Cmd(globals, []string{"cilium_ct*", "cilium_ipcache"}, tt.excluded...)
+		c := exec.Command(cmd[0], cmd[1:]...)
+		c.Env = append(os.Environ(), "PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+		out, err := c.Output()
+		if err != nil {
+			t.Fatalf("script failed: %v", err)
+		}
+
+		stats := Parse(string(out))
+		var names []string
+		for _, st := range stats {
+			if st.Err != nil || st.Method != MethodDump || st.Entries != 1 || st.Info.MaxEntries != 1000 {
+				t.Errorf("unexpected stats %+v", st)
+			}
+			names = append(names, st.Map)
+		}
+		if !slices.Equal(names, tt.want) {
+			t.Errorf("excluding %v: unexpected maps %v in output %s", tt.excluded, names, out)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+// Package bpfcount counts the entries of a pinned BPF map by walking its keys,
+// without copying values or formatting them as bpftool does.
+//
+// The counting side runs inside the inspector pod as the bpf-map-count helper
+// binary (see tools/bpf-map-count); the parsing side runs in kubectl-cilium.
+package bpfcount
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// HelperName is the name of the helper binary looked up on $PATH in the inspector pod.
+const HelperName = "bpf-map-count"
+
+// LookupCmd exits with a non-zero code if the helper binary is not installed.
+var LookupCmd = []string{"sh", "-c", "command -v " + HelperName}
+
+// Count is the output of the helper binary.
+type Count struct {
+	Entries    int `json:"entries"`
+	MaxEntries int `json:"max_entries"`
+}
+
+// Parse decodes the output of the helper binary.
+func Parse(out string) (*Count, error) {
+	c := &Count{}
+	if err := json.Unmarshal([]byte(out), c); err != nil {
+		return nil, fmt.Errorf("failed to decode %s output: %w", HelperName, err)
+	}
+	if c.MaxEntries <= 0 {
+		return nil, fmt.Errorf("%s output has no max_entries", HelperName)
+	}
+	return c, nil
+}
@@ -0,0 +1,21 @@
+package bpfcount
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	count, err := Parse(`{"entries":284970,"max_entries":356212}`)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if count.Entries != 284970 || count.MaxEntries != 356212 {
+		t.Errorf("unexpected count %+v", count)
+	}
+
+	for _, out := range []string{"", "284970", `{"entries":1}`, "Error: bpf obj get"} {
+		if _, err := Parse(out); err == nil {
+			t.Errorf("expected an error for %q", out)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+//go:build linux
+
+package bpfcount
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// bpf(2) commands and flags, see include/uapi/linux/bpf.h
+const (
+	bpfMapGetNextKey  = 4
+	bpfObjGet         = 7
+	bpfObjGetInfoByFD = 15
+
+	bpfFRdonly = 1 << 3
+)
+
+type objGetAttr struct {
+	pathname  uint64
+	bpfFD     uint32
+	fileFlags uint32
+}
+
+type objGetInfoByFDAttr struct {
+	bpfFD   uint32
+	infoLen uint32
+	info    uint64
+}
+
+type mapGetNextKeyAttr struct {
+	mapFD   uint32
+	_       uint32
+	key     uint64
+	nextKey uint64
+}
+
+// mapInfo is the head of struct bpf_map_info. The kernel only fills in as many
+// bytes as we ask for.
+type mapInfo struct {
+	mapType    uint32
+	id         uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	mapFlags   uint32
+}
+
+func bpf(cmd uintptr, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+// CountPinned counts the keys of the map pinned at pinnedPath.
+func CountPinned(pinnedPath string) (*Count, error) {
+	pathname, err := unix.BytePtrFromString(pinnedPath)
+	if err != nil {
+		return nil, err
+	}
+	getAttr := objGetAttr{
+		pathname:  uint64(uintptr(unsafe.Pointer(pathname))),
+		fileFlags: bpfFRdonly,
+	}
+	fd, err := bpf(bpfObjGet, unsafe.Pointer(&getAttr), unsafe.Sizeof(getAttr))
+	runtime.KeepAlive(pathname)
+	if err != nil {
+		return nil, fmt.Errorf("bpf obj get (%s): %w", pinnedPath, err)
+	}
+	defer unix.Close(int(fd))
+
+	info := mapInfo{}
+	infoAttr := objGetInfoByFDAttr{
+		bpfFD:   uint32(fd),
+		infoLen: uint32(unsafe.Sizeof(info)),
+		info:    uint64(uintptr(unsafe.Pointer(&info))),
+	}
+	if _, err := bpf(bpfObjGetInfoByFD, unsafe.Pointer(&infoAttr), unsafe.Sizeof(infoAttr)); err != nil {
+		return nil, fmt.Errorf("bpf obj get info (%s): %w", pinnedPath, err)
+	}
+	if info.keySize == 0 {
+		return nil, fmt.Errorf("map %s has no keys to iterate", pinnedPath)
+	}
+
+	key := make([]byte, info.keySize)
+	nextKey := make([]byte, info.keySize)
+	attr := mapGetNextKeyAttr{
+		mapFD:   uint32(fd),
+		nextKey: uint64(uintptr(unsafe.Pointer(&nextKey[0]))),
+	}
+
+	entries := 0
+	for {
+		_, err := bpf(bpfMapGetNextKey, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		if errors.Is(err, unix.ENOENT) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bpf map get next key (%s): %w", pinnedPath, err)
+		}
+		entries++
+		// The kernel restarts from the first key when the current key is deleted
+		// concurrently, so a busy map can be walked more than once.
+		if entries > int(info.maxEntries) {
+			return nil, fmt.Errorf("map %s changed too fast to be counted", pinnedPath)
+		}
+		copy(key, nextKey)
+		attr.key = uint64(uintptr(unsafe.Pointer(&key[0])))
+	}
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(nextKey)
+
+	return &Count{
+		Entries:    entries,
+		MaxEntries: int(info.maxEntries),
+	}, nil
+}
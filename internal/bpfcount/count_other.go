@@ -0,0 +1,12 @@
+//go:build !linux
+
+package bpfcount
+
+import (
+	"errors"
+)
+
+// CountPinned counts the keys of the map pinned at pinnedPath.
+func CountPinned(pinnedPath string) (*Count, error) {
+	return nil, errors.New("counting BPF maps is only supported on linux")
+}
@@ -0,0 +1,109 @@
+// Package bpfmaps is the catalog of the Cilium BPF maps that kubectl-cilium
+// inspects under /sys/fs/bpf/tc/globals.
+package bpfmaps
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Map describes a pinned Cilium BPF map.
+type Map struct {
+	Name        string
+	Description string
+	// Option is the cilium-agent option that sizes the map. It is empty when
+	// the size is fixed at compile time.
+	Option string
+	// LRU maps evict the least recently used entries when they are full
+	// instead of failing to insert new ones.
+	LRU bool
+	// Family is the IP family the map exists for, or empty for both.
+	Family Family
+}
+
+// Family is an IP family cilium-agent can be configured for.
+type Family string
+
+const (
+	IPv4 Family = "ipv4"
+	IPv6 Family = "ipv6"
+)
+
+// Catalog lists the inspected maps. IPv6 variants follow their IPv4
+// counterparts; maps that do not exist on a node, e.g. with IPv6 disabled,
+// are skipped.
+var Catalog = []Map{
+	{Name: "cilium_ct4_global", Description: "IPv4 TCP connection tracking", Option: "bpf-ct-global-tcp-max", LRU: true, Family: IPv4},
+	{Name: "cilium_ct6_global", Description: "IPv6 TCP connection tracking", Option: "bpf-ct-global-tcp-max", LRU: true, Family: IPv6},
+	{Name: "cilium_ct_any4_global", Description: "IPv4 non-TCP connection tracking", Option: "bpf-ct-global-any-max", LRU: true, Family: IPv4},
+	{Name: "cilium_ct_any6_global", Description: "IPv6 non-TCP connection tracking", Option: "bpf-ct-global-any-max", LRU: true, Family: IPv6},
+	{Name: "cilium_snat_v4_external", Description: "IPv4 SNAT translations", Option: "bpf-nat-global-max", LRU: true, Family: IPv4},
+	{Name: "cilium_snat_v6_external", Description: "IPv6 SNAT translations", Option: "bpf-nat-global-max", LRU: true, Family: IPv6},
+	{Name: "cilium_nodeport_neigh4", Description: "IPv4 neighbors of NodePort backends", Option: "bpf-neigh-global-max", LRU: true, Family: IPv4},
+	{Name: "cilium_nodeport_neigh6", Description: "IPv6 neighbors of NodePort backends", Option: "bpf-neigh-global-max", LRU: true, Family: IPv6},
+	{Name: "cilium_lb4_services_v2", Description: "IPv4 service frontends", Option: "bpf-lb-service-map-max", Family: IPv4},
+	{Name: "cilium_lb6_services_v2", Description: "IPv6 service frontends", Option: "bpf-lb-service-map-max", Family: IPv6},
+	{Name: "cilium_lb4_backends_v3", Description: "IPv4 service backends", Option: "bpf-lb-backend-map-max", Family: IPv4},
+	{Name: "cilium_lb6_backends_v3", Description: "IPv6 service backends", Option: "bpf-lb-backend-map-max", Family: IPv6},
+	{Name: "cilium_lb4_reverse_nat", Description: "IPv4 service reverse NAT", Option: "bpf-lb-rev-nat-map-max", Family: IPv4},
+	{Name: "cilium_lb6_reverse_nat", Description: "IPv6 service reverse NAT", Option: "bpf-lb-rev-nat-map-max", Family: IPv6},
+	{Name: "cilium_lb4_affinity", Description: "IPv4 service session affinity", Option: "bpf-lb-affinity-map-max", LRU: true, Family: IPv4},
+	{Name: "cilium_lb6_affinity", Description: "IPv6 service session affinity", Option: "bpf-lb-affinity-map-max", LRU: true, Family: IPv6},
+	{Name: "cilium_ipv4_frag_datagrams", Description: "IPv4 fragment tracking", Option: "bpf-fragments-map-max", LRU: true, Family: IPv4},
+	{Name: "cilium_ipv6_frag_datagrams", Description: "IPv6 fragment tracking", Option: "bpf-fragments-map-max", LRU: true, Family: IPv6},
+	{Name: "cilium_ipcache", Description: "IP to identity cache"},
+	{Name: "cilium_lxc", Description: "Local endpoints"},
+	{Name: "cilium_tunnel_map", Description: "Tunnel endpoints of remote pod CIDRs"},
+}
+
+// Names returns the names of the maps in the catalog.
+func Names() []string {
+	names := make([]string, 0, len(Catalog))
+	for _, m := range Catalog {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Lookup returns the catalog entry of a map. Per-endpoint policy maps are
+// described by PolicyMap.
+func Lookup(name string) (Map, bool) {
+	if _, ok := PolicyEndpointID(name); ok {
+		return PolicyMap, true
+	}
+	for _, m := range Catalog {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return Map{}, false
+}
+
+// PolicyMapPrefix starts the names of the per-endpoint policy maps, e.g.
+// cilium_policy_01234 or cilium_policy_v2_01234, which end in the endpoint ID.
+const PolicyMapPrefix = "cilium_policy_"
+
+// PolicyMap describes every per-endpoint policy map.
+var PolicyMap = Map{
+	Name:        PolicyMapPrefix + "<endpoint-id>",
+	Description: "Policy of a local endpoint",
+	Option:      "bpf-policy-map-max",
+}
+
+// PolicyEndpointID returns the endpoint ID of a per-endpoint policy map, or
+// false if the name is not one of a policy map.
+func PolicyEndpointID(name string) (int, bool) {
+	id, ok := strings.CutPrefix(name, PolicyMapPrefix)
+	if !ok {
+		return 0, false
+	}
+	id = strings.TrimPrefix(id, "v2_")
+	if id == "" || strings.Trim(id, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
@@ -0,0 +1,32 @@
+package bpfmaps
+
+import "testing"
+
+func TestPolicyEndpointID(t *testing.T) {
+	tests := map[string]int{
+		"cilium_policy_01234":    1234,
+		"cilium_policy_v2_00042": 42,
+	}
+	for name, want := range tests {
+		if id, ok := PolicyEndpointID(name); !ok || id != want {
+			t.Errorf("%s: expected endpoint %d, got %d %v", name, want, id, ok)
+		}
+	}
+	for _, name := range []string{"cilium_policy_", "cilium_policy_v2_", "cilium_policy_reserved", "cilium_call_policy", "cilium_ct4_global"} {
+		if _, ok := PolicyEndpointID(name); ok {
+			t.Errorf("%s: expected no endpoint", name)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if m, ok := Lookup("cilium_lb4_affinity"); !ok || !m.LRU || m.Option != "bpf-lb-affinity-map-max" {
+		t.Errorf("unexpected catalog entry %+v", m)
+	}
+	if m, ok := Lookup("cilium_policy_00042"); !ok || m.Option != "bpf-policy-map-max" {
+		t.Errorf("unexpected policy map entry %+v", m)
+	}
+	if _, ok := Lookup("cilium_unknown"); ok {
+		t.Errorf("expected no entry for an unknown map")
+	}
+}
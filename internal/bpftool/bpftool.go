@@ -0,0 +1,165 @@
+package bpftool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MapInfo is the subset of `bpftool -j map show` we rely on.
+type MapInfo struct {
+	ID         int    `json:"id"`
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Flags      int    `json:"flags"`
+	KeySize    int    `json:"bytes_key"`
+	ValueSize  int    `json:"bytes_value"`
+	MaxEntries int    `json:"max_entries"`
+	Memlock    int64  `json:"bytes_memlock"`
+}
+
+// usageTypes are the map types whose entries are inserted and deleted. The
+// other types, e.g. array and prog_array, are preallocated and always dump
+// all of their slots, so their usage says nothing about pressure.
+var usageTypes = []string{"hash", "lru_hash", "percpu_hash", "lru_percpu_hash", "lpm_trie", "hash_of_maps"}
+
+// HasUsage reports whether the usage of the map is meaningful. Maps of an
+// unknown type, e.g. read through cilium-dbg, are assumed to be.
+func (i MapInfo) HasUsage() bool {
+	return i.Type == "" || slices.Contains(usageTypes, i.Type)
+}
+
+// errorOutput is what bpftool prints to stdout in JSON mode when it fails.
+type errorOutput struct {
+	Error string `json:"error"`
+}
+
+// ParseMapShow decodes the output of `bpftool -j map show pinned <path>`.
+func ParseMapShow(out string) (*MapInfo, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(out), &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode bpftool map show output: %w", err)
+	}
+	if msg, ok := raw["error"]; ok {
+		return nil, fmt.Errorf("bpftool: %s", strings.Trim(string(msg), `"`))
+	}
+
+	info := &MapInfo{}
+	if err := json.Unmarshal([]byte(out), info); err != nil {
+		return nil, fmt.Errorf("failed to decode bpftool map show output: %w", err)
+	}
+	if info.MaxEntries <= 0 {
+		return nil, fmt.Errorf("bpftool map show output has no max_entries")
+	}
+	return info, nil
+}
+
+// CountDecoded counts the elements of the output of `bpftool -j map dump` that
+// dec is about to decode, e.g. when the dump is embedded in a larger document,
+// without keeping the decoded entries in memory.
+func CountDecoded(dec *json.Decoder) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode bpftool map dump output: %w", err)
+	}
+	switch tok {
+	case json.Delim('['):
+	case json.Delim('{'):
+		// Not a dump but an error report, e.g. {"error":"bpf obj get (...): No such file or directory"}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return 0, fmt.Errorf("failed to decode bpftool map dump output: %w", err)
+			}
+			var value json.RawMessage
+			if err := dec.Decode(&value); err != nil {
+				return 0, fmt.Errorf("failed to decode bpftool map dump output: %w", err)
+			}
+			if key == "error" {
+				var msg string
+				_ = json.Unmarshal(value, &msg)
+				return 0, fmt.Errorf("bpftool: %s", msg)
+			}
+		}
+		return 0, errors.New("unexpected bpftool map dump output")
+	default:
+		return 0, fmt.Errorf("unexpected bpftool map dump output: %v", tok)
+	}
+
+	count := 0
+	for dec.More() {
+		var entry json.RawMessage
+		if err := dec.Decode(&entry); err != nil {
+			return 0, fmt.Errorf("failed to decode bpftool map dump entry %d: %w", count, err)
+		}
+		count++
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return 0, fmt.Errorf("truncated bpftool map dump output: %w", err)
+	}
+	return count, nil
+}
+
+// Entry is a single element of the output of `bpftool -j map dump`. Key and Value are
+// arrays of hex bytes, or objects when the map has BTF.
+type Entry struct {
+	Key   json.RawMessage `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MapSampleCmd dumps the start of a map. The output is cut after maxBytes, so
+// that sampling a large map does not stream all of it over the exec channel.
+func MapSampleCmd(pinnedPath string, maxBytes int) []string {
+	return []string{"sh", "-c", fmt.Sprintf("bpftool -j map dump pinned %s | head -c %d", pinnedPath, maxBytes)}
+}
+
+// SampleEntries decodes up to limit entries of the output of MapSampleCmd.
+// Output cut in the middle of an entry is not an error, the complete entries
+// before it are returned.
+func SampleEntries(out string, limit int) ([]Entry, error) {
+	var report errorOutput
+	if json.Unmarshal([]byte(out), &report) == nil && report.Error != "" {
+		return nil, fmt.Errorf("bpftool: %s", report.Error)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(out))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode bpftool map dump output: %w", err)
+	}
+	if tok != json.Delim('[') {
+		return nil, fmt.Errorf("unexpected bpftool map dump output: %v", tok)
+	}
+
+	entries := []Entry{}
+	for len(entries) < limit && dec.More() {
+		var entry Entry
+		if err := dec.Decode(&entry); err != nil {
+			break
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// FormatValue renders a key or value of an Entry on one line. Hex byte arrays
+// are joined without the 0x prefix, BTF objects are kept as compact JSON.
+func FormatValue(raw json.RawMessage) string {
+	var hexBytes []string
+	if err := json.Unmarshal(raw, &hexBytes); err == nil {
+		for i, b := range hexBytes {
+			hexBytes[i] = strings.TrimPrefix(b, "0x")
+		}
+		return strings.Join(hexBytes, " ")
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
@@ -0,0 +1,104 @@
+package bpftool
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseMapShow(t *testing.T) {
+	out := `{"id":42,"type":"lru_hash","name":"cilium_ct4_glob","flags":0,"bytes_key":14,"bytes_value":56,"max_entries":356212,"bytes_memlock":30656512,"frozen":0,"pinned":["/sys/fs/bpf/tc/globals/cilium_ct4_global"]}`
+
+	info, err := ParseMapShow(out)
+	if err != nil {
+		t.Fatalf("ParseMapShow: %v", err)
+	}
+	want := MapInfo{ID: 42, Type: "lru_hash", Name: "cilium_ct4_glob", KeySize: 14, ValueSize: 56, MaxEntries: 356212, Memlock: 30656512}
+	if *info != want {
+		t.Errorf("expected %+v, got %+v", want, *info)
+	}
+}
+
+func TestParseMapShowErrors(t *testing.T) {
+	tests := map[string]string{
+		"bpftool error":   `{"error":"bpf obj get (/sys/fs/bpf/tc/globals): No such file or directory"}`,
+		"not json":        `max_entries 356212`,
+		"no max_entries":  `{"id":42,"type":"hash"}`,
+		"empty output":    ``,
+		"truncated input": `{"id":42,`,
+	}
+	for name, out := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseMapShow(out); err == nil {
+				t.Errorf("expected an error for %q", out)
+			}
+		})
+	}
+}
+
+func TestCountDecoded(t *testing.T) {
+	tests := []struct {
+		name  string
+		out   string
+		count int
+	}{
+		{"empty", `[]`, 0},
+		{"raw", `[{"key":["0x0a","0x00"],"value":["0x01"]},{"key":["0x0b","0x00"],"value":["0x02"]}]`, 2},
+		{"btf", `[{"key":{"daddr":1,"saddr":2},"value":{"packets":3}},{"key":{"daddr":4,"saddr":5},"value":{"packets":6}},{"key":{"daddr":7,"saddr":8},"value":{"packets":9}}]`, 3},
+		{"pretty", "[\n  {\n    \"key\": [\"0x0a\"],\n    \"value\": [\"0x01\"]\n  }\n]\n", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := CountDecoded(json.NewDecoder(strings.NewReader(tt.out)))
+			if err != nil {
+				t.Fatalf("CountDecoded: %v", err)
+			}
+			if count != tt.count {
+				t.Errorf("expected %d entries, got %d", tt.count, count)
+			}
+		})
+	}
+}
+
+func TestCountDecodedErrors(t *testing.T) {
+	tests := map[string]string{
+		"bpftool error": `{"error":"bpf obj get (/sys/fs/bpf/tc/globals): No such file or directory"}`,
+		"truncated":     `[{"key":["0x0a"],"value":["0x01"]},{"key":`,
+		"not an array":  `Found 10 elements`,
+		"empty":         ``,
+	}
+	for name, out := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := CountDecoded(json.NewDecoder(strings.NewReader(out))); err == nil {
+				t.Errorf("expected an error for %q", out)
+			}
+		})
+	}
+}
+
+func TestSampleEntries(t *testing.T) {
+	out := `[{"key":["0x0a","0x00"],"value":["0x01"]},{"key":{"daddr":1},"value":{"packets":3}},{"key":["0x0c"],"val`
+
+	entries, err := SampleEntries(out, 10)
+	if err != nil {
+		t.Fatalf("SampleEntries: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the 2 complete entries, got %d", len(entries))
+	}
+	if got := FormatValue(entries[0].Key); got != "0a 00" {
+		t.Errorf("unexpected raw key %q", got)
+	}
+	if got := FormatValue(entries[1].Value); got != `{"packets":3}` {
+		t.Errorf("unexpected btf value %q", got)
+	}
+
+	entries, err = SampleEntries(out, 1)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("expected 1 entry, got %d: %v", len(entries), err)
+	}
+
+	if _, err := SampleEntries(`{"error":"bpf obj get: No such file or directory"}`, 10); err == nil {
+		t.Errorf("expected an error for a bpftool error report")
+	}
+}
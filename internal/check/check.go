@@ -0,0 +1,188 @@
+// Package check is the framework the diagnostics are built on. A check
+// collects data from the nodes of a cluster, evaluates it against the
+// thresholds into a report, and the report is rendered in the output format
+// of the command. Checks are registered so that commands can be generated for
+// them and they can be run together.
+package check
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/threshold"
+)
+
+// Status is the outcome of a check for a single subject on a single node.
+type Status string
+
+const (
+	Unknown  Status = "Unknown"
+	OK       Status = "OK"
+	Warning  Status = "Warning"
+	Critical Status = "Critical"
+)
+
+var statusLabels = map[Status]string{
+	Unknown:  "[Unknown]",
+	OK:       "[O.K.]",
+	Warning:  "[Warning]",
+	Critical: "[Critical]",
+}
+
+var statusRanks = map[Status]int{
+	Critical: 0,
+	Warning:  1,
+	OK:       2,
+	Unknown:  3,
+}
+
+// Label is the status as shown in tables.
+func (s Status) Label() string {
+	return statusLabels[s]
+}
+
+// Rank orders the statuses by severity, Critical first and Unknown last.
+func (s Status) Rank() int {
+	rank, ok := statusRanks[s]
+	if !ok {
+		return len(statusRanks)
+	}
+	return rank
+}
+
+// StatusOf returns the status of a threshold level.
+func StatusOf(level threshold.Level) Status {
+	switch level {
+	case threshold.Critical:
+		return Critical
+	case threshold.Warning:
+		return Warning
+	default:
+		return OK
+	}
+}
+
+// Finding is the evaluated outcome for a single subject, e.g. a map, on a
+// single node.
+type Finding struct {
+	Node    string
+	Subject string
+	Status  Status
+	// Usage is the usage of the subject in percent.
+	Usage float64
+	// Error explains an Unknown status.
+	Error string
+	// Hint is the remediation for a Warning or Critical status, if known.
+	Hint string
+}
+
+// Table is the rendering of a report in the table formats.
+type Table struct {
+	Header []string
+	Rows   [][]string
+	// Notes are printed below the table.
+	Notes []string
+}
+
+// Report is the evaluated outcome of a check. The structured formats encode
+// the report itself, so it is expected to be a versioned result document.
+type Report interface {
+	Findings() []Finding
+	Table(wide bool) Table
+}
+
+// Check is a diagnostic run against the nodes of a cluster.
+type Check interface {
+	// Collect inspects the nodes selected by the filter.
+	Collect(ctx context.Context, nodes NodeFilter) error
+	// Evaluate classifies what the last Collect found.
+	Evaluate() Report
+}
+
+// Watcher is implemented by checks that can re-run and redraw their report
+// until ctx is cancelled.
+type Watcher interface {
+	Watch(ctx context.Context, nodes NodeFilter, interval time.Duration) error
+}
+
+// DefaultConcurrency is the number of nodes inspected in parallel.
+const DefaultConcurrency = 10
+
+// Options are shared by all checks.
+type Options struct {
+	// Output selects how the report is rendered.
+	Output output.Format
+	// Thresholds decides when a subject is reported as Warning or Critical.
+	// The defaults are used when it is nil.
+	Thresholds *threshold.Config
+	// Concurrency bounds the nodes inspected in parallel.
+	// DefaultConcurrency is used when it is not positive.
+	Concurrency int
+}
+
+// WithDefaults returns the options with the defaults of the unset fields.
+func (o Options) WithDefaults() Options {
+	if o.Output == "" {
+		o.Output = output.Table
+	}
+	if o.Thresholds == nil {
+		o.Thresholds = threshold.Default()
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = DefaultConcurrency
+	}
+	return o
+}
+
+// Run collects, evaluates and renders a check.
+func Run(ctx context.Context, c Check, nodes NodeFilter, w io.Writer, format output.Format) (Report, error) {
+	err := c.Collect(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+	report := c.Evaluate()
+	err = Render(w, format, report)
+	if err != nil {
+		return report, fmt.Errorf("failed to print results: %w", err)
+	}
+	return report, nil
+}
+
+// Render writes the report in the given format.
+func Render(w io.Writer, format output.Format, report Report) error {
+	if format.IsStructured() {
+		return output.Encode(w, format, report)
+	}
+	return RenderTable(w, report.Table(format == output.Wide))
+}
+
+// RenderTable writes the table with aligned columns, followed by its notes.
+func RenderTable(w io.Writer, t Table) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "\n%s\n", strings.Join(t.Header, "\t"))
+	for _, row := range t.Rows {
+		fmt.Fprintf(tw, "%s\n", strings.Join(row, "\t"))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush tab writer: %w", err)
+	}
+	for _, note := range t.Notes {
+		fmt.Fprint(w, note)
+	}
+	return nil
+}
+
+// Statuses returns the status of every finding of the report.
+func Statuses(report Report) []Status {
+	var statuses []Status
+	for _, finding := range report.Findings() {
+		statuses = append(statuses, finding.Status)
+	}
+	return statuses
+}
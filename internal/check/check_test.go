@@ -0,0 +1,334 @@
+package check
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/threshold"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeReport struct {
+	Items []Finding `json:"items"`
+}
+
+func (r *fakeReport) Findings() []Finding {
+	return r.Items
+}
+
+func (r *fakeReport) Table(wide bool) Table {
+	t := Table{Header: []string{"STATUS", "NODE"}, Notes: []string{"note\n"}}
+	if wide {
+		t.Header = append(t.Header, "SUBJECT")
+	}
+	for _, item := range r.Items {
+		row := []string{item.Status.Label(), item.Node}
+		if wide {
+			row = append(row, item.Subject)
+		}
+		t.Rows = append(t.Rows, row)
+	}
+	return t
+}
+
+type fakeCheck struct {
+	nodes  []string
+	report *fakeReport
+}
+
+func (c *fakeCheck) Collect(ctx context.Context, nodes NodeFilter) error {
+	for _, name := range c.nodes {
+		if nodes.Match(name) {
+			c.report.Items = append(c.report.Items, Finding{Node: name, Subject: "map", Status: OK})
+		}
+	}
+	return nil
+}
+
+func (c *fakeCheck) Evaluate() Report {
+	return c.report
+}
+
+func TestStatus(t *testing.T) {
+	statuses := []Status{Unknown, OK, Critical, Warning}
+	slices.SortFunc(statuses, func(a, b Status) int {
+		return a.Rank() - b.Rank()
+	})
+	if want := []Status{Critical, Warning, OK, Unknown}; !slices.Equal(statuses, want) {
+		t.Errorf("expected %v, got %v", want, statuses)
+	}
+
+	levels := map[threshold.Level]Status{threshold.OK: OK, threshold.Warning: Warning, threshold.Critical: Critical}
+	for level, want := range levels {
+		if status := StatusOf(level); status != want {
+			t.Errorf("%s: expected %s, got %s", level, want, status)
+		}
+	}
+	if label := Critical.Label(); label != "[Critical]" {
+		t.Errorf("expected [Critical], got %s", label)
+	}
+}
+
+func TestRun(t *testing.T) {
+	c := &fakeCheck{nodes: []string{"node-1", "node-2"}, report: &fakeReport{}}
+	out := &bytes.Buffer{}
+
+	report, err := Run(context.Background(), c, NodeFilter{Names: []string{"node-2"}}, out, output.Table)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if statuses := Statuses(report); !slices.Equal(statuses, []Status{OK}) {
+		t.Errorf("expected [OK], got %v", statuses)
+	}
+	if got, want := out.String(), "\nSTATUS   NODE\n[O.K.]   node-2\nnote\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	report := &fakeReport{Items: []Finding{{Node: "node-1", Subject: "map", Status: Warning}}}
+
+	out := &bytes.Buffer{}
+	if err := Render(out, output.Wide, report); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out.String(), "SUBJECT") || !strings.Contains(out.String(), "[Warning]") {
+		t.Errorf("unexpected wide output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := Render(out, output.JSON, report); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out.String(), `"Status": "Warning"`) || strings.Contains(out.String(), "note") {
+		t.Errorf("unexpected JSON output:\n%s", out.String())
+	}
+}
+
+func testNode(name, pool string, ready, unschedulable bool) *corev1.Node {
+	status := corev1.ConditionFalse
+	if ready {
+		status = corev1.ConditionTrue
+	}
+	return &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"pool": pool}},
+		Spec:       corev1.NodeSpec{Unschedulable: unschedulable},
+		Status:     corev1.NodeStatus{Conditions: []corev1.NodeCondition{{Type: corev1.NodeReady, Status: status}}},
+	}
+}
+
+func testAgentPod(nodeName string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "cilium-" + nodeName, Namespace: "kube-system", Labels: map[string]string{"k8s-app": "cilium"}},
+		Spec:       corev1.PodSpec{NodeName: nodeName},
+	}
+}
+
+func TestNodeFilter(t *testing.T) {
+	kc := k8sfake.NewClientset(
+		testNode("node-1", "default", true, false),
+		testNode("node-2", "default", false, false),
+		testNode("gpu-1", "gpu", true, false),
+		testNode("gpu-2", "gpu", true, true),
+		testAgentPod("node-1"), testAgentPod("node-2"), testAgentPod("gpu-1"), testAgentPod("gpu-2"),
+	)
+
+	tests := []struct {
+		name   string
+		filter NodeFilter
+		want   []string
+	}{
+		{"all", NodeFilter{}, []string{"gpu-1", "gpu-2", "node-1", "node-2"}},
+		{"names", NodeFilter{Names: []string{"node-2", "gpu-1"}}, []string{"gpu-1", "node-2"}},
+		{"pattern", NodeFilter{Pattern: regexp.MustCompile(`^node-`)}, []string{"node-1", "node-2"}},
+		{"selector", NodeFilter{Selector: "pool=gpu"}, []string{"gpu-1", "gpu-2"}},
+		{"exclude unschedulable", NodeFilter{Selector: "pool=gpu", ExcludeUnschedulable: true}, []string{"gpu-1"}},
+		{"only ready", NodeFilter{Pattern: regexp.MustCompile(`^node-`), OnlyReady: true}, []string{"node-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodes, err := tt.filter.Nodes(context.Background(), kc)
+			if err != nil {
+				t.Fatalf("Nodes: %v", err)
+			}
+			var got []string
+			for _, node := range nodes {
+				got = append(got, node.Name)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected nodes %v, got %v", tt.want, got)
+			}
+
+			pods, err := tt.filter.AgentPods(context.Background(), kc)
+			if err != nil {
+				t.Fatalf("AgentPods: %v", err)
+			}
+			got = nil
+			for _, pod := range pods {
+				got = append(got, pod.Spec.NodeName)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected the agent pods of %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNodeFilterSample(t *testing.T) {
+	var objects []runtime.Object
+	for i := range 20 {
+		objects = append(objects, testNode(fmt.Sprintf("node-%02d", i), "default", true, false))
+	}
+	kc := k8sfake.NewClientset(objects...)
+
+	filter := NodeFilter{Sample: 5, Seed: 42}
+	first, err := filter.Nodes(context.Background(), kc)
+	if err != nil {
+		t.Fatalf("Nodes: %v", err)
+	}
+	second, _ := filter.Nodes(context.Background(), kc)
+	if len(first) != 5 || !slices.EqualFunc(first, second, func(a, b corev1.Node) bool { return a.Name == b.Name }) {
+		t.Errorf("expected the same 5 nodes for the same seed, got %d and %d", len(first), len(second))
+	}
+	if !slices.IsSortedFunc(first, func(a, b corev1.Node) int { return strings.Compare(a.Name, b.Name) }) {
+		t.Error("expected the sample to be ordered by name")
+	}
+
+	all, _ := NodeFilter{Sample: 50}.Nodes(context.Background(), kc)
+	if len(all) != 20 {
+		t.Errorf("expected all 20 nodes when the sample is larger, got %d", len(all))
+	}
+}
+
+func TestForEach(t *testing.T) {
+	var sum atomic.Int64
+	ForEach(context.Background(), 2, []int{1, 2, 3, 4}, func(i int) {
+		sum.Add(int64(i))
+	})
+	if sum.Load() != 10 {
+		t.Errorf("expected 10, got %d", sum.Load())
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register(Definition{Name: "test-b"})
+	Register(Definition{Name: "test-a"})
+
+	var names []string
+	for _, def := range Definitions() {
+		names = append(names, def.Name)
+	}
+	if !slices.Equal(names, []string{"test-a", "test-b"}) {
+		t.Errorf("expected [test-a test-b], got %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic registering test-a twice")
+		}
+	}()
+	Register(Definition{Name: "test-a"})
+}
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster: {server: https://prod.example.com}
+- name: staging
+  cluster: {server: https://staging.example.com}
+users:
+- name: admin
+  user: {token: secret}
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+- name: staging
+  context: {cluster: staging, user: admin}
+current-context: prod
+`
+
+func TestNewEnv(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(filename, []byte(testKubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KUBECONFIG", filename)
+
+	flags := genericclioptions.NewConfigFlags(false)
+	*flags.Context = "staging"
+	if _, err := NewEnv(flags); err != nil {
+		t.Fatalf("NewEnv: %v", err)
+	}
+	config, _ := flags.ToRESTConfig()
+	if config.Host != "https://staging.example.com" {
+		t.Errorf("expected the staging cluster from $KUBECONFIG, got %s", config.Host)
+	}
+
+	*flags.Context = "missing"
+	if _, err := NewEnv(flags); err == nil {
+		t.Error("expected an error for a missing context")
+	}
+}
+
+type failingCheck struct{}
+
+func (failingCheck) Collect(ctx context.Context, nodes NodeFilter) error {
+	return errors.New("connection refused")
+}
+
+func (failingCheck) Evaluate() Report {
+	return nil
+}
+
+func TestRunClusters(t *testing.T) {
+	clusters := []Cluster{
+		{Name: "prod", Check: &fakeCheck{nodes: []string{"node-1"}, report: &fakeReport{}}},
+		{Name: "staging", Check: failingCheck{}},
+		{Name: "missing", Err: errors.New(`context "missing" does not exist`)},
+		{Name: "dev", Check: &fakeCheck{nodes: []string{"node-1", "node-2"}, report: &fakeReport{}}},
+	}
+
+	report := RunClusters(context.Background(), clusters, 2, NodeFilter{})
+	var names []string
+	for _, result := range report.Clusters {
+		names = append(names, result.Cluster)
+	}
+	if !slices.Equal(names, []string{"prod", "staging", "missing", "dev"}) {
+		t.Errorf("expected the clusters in order, got %v", names)
+	}
+
+	var nodes []string
+	for _, f := range report.Findings() {
+		nodes = append(nodes, string(f.Status)+":"+f.Node)
+	}
+	want := []string{"OK:prod/node-1", "Unknown:staging", "Unknown:missing", "OK:dev/node-1", "OK:dev/node-2"}
+	if !slices.Equal(nodes, want) {
+		t.Errorf("expected findings %v, got %v", want, nodes)
+	}
+
+	out := &bytes.Buffer{}
+	if err := Render(out, output.Table, report); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	for _, s := range []string{"CLUSTER   STATUS   NODE", "prod      [O.K.]   node-1", "dev       [O.K.]   node-2", "Cluster dev:note", "Cluster staging failed: connection refused"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("expected %q in the output:\n%s", s, out.String())
+		}
+	}
+}
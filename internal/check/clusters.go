@@ -0,0 +1,121 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ClustersAPIVersion is the version of the machine-readable schema of the
+// reports merged across clusters.
+const ClustersAPIVersion = "kubectl-cilium/v1alpha1"
+
+const clustersKind = "MultiClusterResult"
+
+// Cluster is a check to run against one cluster, e.g. a kubeconfig context.
+type Cluster struct {
+	Name  string
+	Check Check
+	// Err tells why the check could not be created for the cluster, e.g. a
+	// missing context. The cluster is then reported as failed.
+	Err error
+}
+
+// ClusterResult is the report of a check in one cluster, in the schema of
+// the check.
+type ClusterResult struct {
+	Cluster string `json:"cluster"`
+	Error   string `json:"error,omitempty"`
+	Result  Report `json:"result,omitempty"`
+}
+
+// ClustersReport merges the reports of a check across clusters.
+type ClustersReport struct {
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Clusters   []ClusterResult `json:"clusters"`
+}
+
+// RunClusters collects and evaluates the check of every cluster, at most
+// concurrency clusters at a time. A cluster that fails, e.g. because its API
+// server is unreachable, is reported and does not affect the others.
+func RunClusters(ctx context.Context, clusters []Cluster, concurrency int, nodes NodeFilter) *ClustersReport {
+	results := make([]ClusterResult, len(clusters))
+	indexes := make([]int, len(clusters))
+	for i, cluster := range clusters {
+		// Clusters that are not started once ctx is cancelled stay failed.
+		results[i] = ClusterResult{Cluster: cluster.Name, Error: "interrupted"}
+		indexes[i] = i
+	}
+
+	ForEach(ctx, concurrency, indexes, func(i int) {
+		cluster := clusters[i]
+		result := ClusterResult{Cluster: cluster.Name}
+		err := cluster.Err
+		if err == nil {
+			err = cluster.Check.Collect(ctx, nodes)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cluster %s failed: %v\n", cluster.Name, err)
+			result.Error = err.Error()
+		} else {
+			result.Result = cluster.Check.Evaluate()
+		}
+		results[i] = result
+	})
+
+	return &ClustersReport{
+		APIVersion: ClustersAPIVersion,
+		Kind:       clustersKind,
+		Clusters:   results,
+	}
+}
+
+// Findings returns the findings of all clusters, with the nodes prefixed by
+// their cluster, and an Unknown finding for every cluster that failed.
+func (r *ClustersReport) Findings() []Finding {
+	var findings []Finding
+	for _, result := range r.Clusters {
+		if result.Result == nil {
+			findings = append(findings, Finding{Node: result.Cluster, Status: Unknown, Error: result.Error})
+			continue
+		}
+		for _, f := range result.Result.Findings() {
+			f.Node = result.Cluster + "/" + f.Node
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// Table merges the tables of the clusters into one with a CLUSTER column. The
+// notes of every cluster follow under its name, then the failed clusters.
+func (r *ClustersReport) Table(wide bool) Table {
+	var t Table
+	var failures []string
+	for _, result := range r.Clusters {
+		if result.Result == nil {
+			failures = append(failures, fmt.Sprintf("Cluster %s failed: %s\n", result.Cluster, result.Error))
+			continue
+		}
+		clusterTable := result.Result.Table(wide)
+		if t.Header == nil {
+			t.Header = append([]string{"CLUSTER"}, clusterTable.Header...)
+		}
+		for _, row := range clusterTable.Rows {
+			t.Rows = append(t.Rows, append([]string{result.Cluster}, row...))
+		}
+		if len(clusterTable.Notes) > 0 {
+			t.Notes = append(t.Notes, fmt.Sprintf("\nCluster %s:", result.Cluster))
+			t.Notes = append(t.Notes, clusterTable.Notes...)
+		}
+	}
+	if t.Header == nil {
+		t.Header = []string{"CLUSTER"}
+	}
+	if len(failures) > 0 {
+		t.Notes = append(t.Notes, "\n")
+		t.Notes = append(t.Notes, failures...)
+	}
+	return t
+}
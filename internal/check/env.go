@@ -0,0 +1,56 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/executor"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Env holds the clients the checks talk to the cluster with.
+type Env struct {
+	Client   kubernetes.Interface
+	Executor executor.CommandExecutor
+	// Dynamic reads custom resources, such as CiliumEndpoints. Checks skip
+	// what needs it when it is nil.
+	Dynamic dynamic.Interface
+	// Maps, if set, shares the maps read during a run between the checks.
+	Maps *MapCache
+}
+
+// NewEnv builds the clients from the REST config of getter, e.g. the
+// kubeconfig, context and credentials flags of kubectl.
+func NewEnv(getter genericclioptions.RESTClientGetter) (*Env, error) {
+	config, err := getter.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+	dc, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	return &Env{
+		Client:   clientset,
+		Executor: executor.NewSPDYExecutor(clientset, config),
+		Dynamic:  dc,
+	}, nil
+}
+
+// Exec runs cmd in a container of pod and returns its stdout, giving up after
+// timeout.
+func (e *Env) Exec(ctx context.Context, pod *corev1.Pod, container string, cmd []string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return e.Executor.Exec(ctx, pod, container, cmd)
+}
@@ -0,0 +1,45 @@
+package check
+
+import (
+	"sync"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+)
+
+// MapStats is what a check read of a pinned map of a node.
+type MapStats struct {
+	Info           bpftool.MapInfo
+	CurrentEntries int
+}
+
+// MapCache shares the maps read by a check with the checks that run after
+// it, so that a map is read once per node. A nil cache stores nothing.
+type MapCache struct {
+	mu   sync.RWMutex
+	maps map[[2]string]MapStats
+}
+
+func NewMapCache() *MapCache {
+	return &MapCache{maps: make(map[[2]string]MapStats)}
+}
+
+// Store records the stats of a map of a node.
+func (c *MapCache) Store(nodeName, mapName string, stats MapStats) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maps[[2]string{nodeName, mapName}] = stats
+}
+
+// Load returns the stats of a map of a node, if a check read them.
+func (c *MapCache) Load(nodeName, mapName string) (MapStats, bool) {
+	if c == nil {
+		return MapStats{}, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	stats, ok := c.maps[[2]string{nodeName, mapName}]
+	return stats, ok
+}
@@ -0,0 +1,137 @@
+package check
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AgentSelector selects the cilium-agent pods in ciliumconfig.Namespace.
+	AgentSelector = "k8s-app=cilium"
+	// AgentContainer is the container of the agent in its pods.
+	AgentContainer = "cilium-agent"
+)
+
+// NodeFilter selects the nodes a check inspects. The zero value selects all
+// nodes.
+type NodeFilter struct {
+	// Names selects the nodes by name.
+	Names []string
+	// Selector selects the nodes by label, e.g. a node pool.
+	Selector string
+	// Pattern selects the nodes whose name it matches.
+	Pattern *regexp.Regexp
+	// ExcludeUnschedulable skips the cordoned nodes.
+	ExcludeUnschedulable bool
+	// OnlyReady skips the nodes that are not Ready.
+	OnlyReady bool
+	// Sample, if positive, selects a random subset of that many of the
+	// matching nodes.
+	Sample int
+	// Seed seeds the random subset, so that the checks of a run, e.g. of the
+	// doctor, sample the same nodes.
+	Seed uint64
+}
+
+// Match reports whether the filter selects the named node by its name. The
+// other criteria need the node, see Nodes.
+func (f NodeFilter) Match(nodeName string) bool {
+	if len(f.Names) > 0 && !slices.Contains(f.Names, nodeName) {
+		return false
+	}
+	return f.Pattern == nil || f.Pattern.MatchString(nodeName)
+}
+
+// byName reports whether the filter only selects the nodes by their name.
+func (f NodeFilter) byName() bool {
+	return f.Selector == "" && !f.ExcludeUnschedulable && !f.OnlyReady && f.Sample <= 0
+}
+
+func (f NodeFilter) matchNode(node *corev1.Node) bool {
+	if !f.Match(node.Name) {
+		return false
+	}
+	if f.ExcludeUnschedulable && node.Spec.Unschedulable {
+		return false
+	}
+	return !f.OnlyReady || nodeReady(node)
+}
+
+func nodeReady(node *corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// Nodes returns the nodes selected by the filter, ordered by name.
+func (f NodeFilter) Nodes(ctx context.Context, kc kubernetes.Interface) ([]corev1.Node, error) {
+	nodes, err := kc.CoreV1().Nodes().List(ctx, metav1.ListOptions{LabelSelector: f.Selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var selected []corev1.Node
+	for _, node := range nodes.Items {
+		if f.matchNode(&node) {
+			selected = append(selected, node)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].Name < selected[j].Name
+	})
+
+	if f.Sample > 0 && len(selected) > f.Sample {
+		r := rand.New(rand.NewPCG(f.Seed, 0))
+		r.Shuffle(len(selected), func(i, j int) {
+			selected[i], selected[j] = selected[j], selected[i]
+		})
+		selected = selected[:f.Sample]
+		sort.Slice(selected, func(i, j int) bool {
+			return selected[i].Name < selected[j].Name
+		})
+	}
+	return selected, nil
+}
+
+// AgentPods returns the cilium-agent pods of the nodes selected by the filter.
+func (f NodeFilter) AgentPods(ctx context.Context, kc kubernetes.Interface) ([]corev1.Pod, error) {
+	match := f.Match
+	if !f.byName() {
+		nodes, err := f.Nodes(ctx, kc)
+		if err != nil {
+			return nil, err
+		}
+		names := make(map[string]bool, len(nodes))
+		for _, node := range nodes {
+			names[node.Name] = true
+		}
+		match = func(nodeName string) bool {
+			return names[nodeName]
+		}
+	}
+
+	pods, err := kc.CoreV1().Pods(ciliumconfig.Namespace).List(ctx, metav1.ListOptions{LabelSelector: AgentSelector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cilium-agent pods: %w", err)
+	}
+
+	var selected []corev1.Pod
+	for _, pod := range pods.Items {
+		if match(pod.Spec.NodeName) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,24 @@
+package check
+
+import (
+	"context"
+
+	"github.com/alitto/pond/v2"
+)
+
+// ForEach calls fn for every item, at most concurrency at a time, and returns
+// once all calls are done. Items not started yet are skipped once ctx is
+// cancelled.
+func ForEach[T any](ctx context.Context, concurrency int, items []T, fn func(T)) {
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	pool := pond.NewPool(concurrency, pond.WithContext(ctx))
+	for _, item := range items {
+		pool.Submit(func() {
+			fn(item)
+		})
+	}
+	pool.StopAndWait()
+}
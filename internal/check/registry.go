@@ -0,0 +1,63 @@
+package check
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Definition describes a check, so that a command can be generated for it
+// and it can be run with the other checks.
+type Definition struct {
+	// Name is the name of the command of the check.
+	Name  string
+	Short string
+	Long  string
+	// Prompt is the confirmation asked before the check runs.
+	Prompt string
+	// WatchInterval, if set, is the default interval of the --watch mode. The
+	// check must implement Watcher.
+	WatchInterval time.Duration
+	// StoresMaps tells that the check stores the maps it reads in Env.Maps,
+	// so it runs before the checks that can reuse them.
+	StoresMaps bool
+	// AddFlags adds the flags specific to the check.
+	AddFlags func(flags *pflag.FlagSet)
+	// New creates the check. flags holds the flags added by AddFlags.
+	New func(env *Env, opts Options, flags *pflag.FlagSet) (Check, error)
+}
+
+var (
+	registryMu  sync.RWMutex
+	definitions = map[string]Definition{}
+)
+
+// Register makes a check available. It panics if a check with the same name
+// is already registered.
+func Register(def Definition) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := definitions[def.Name]; ok {
+		panic(fmt.Sprintf("check %s is already registered", def.Name))
+	}
+	definitions[def.Name] = def
+}
+
+// Definitions returns the registered checks ordered by name.
+func Definitions() []Definition {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	defs := make([]Definition, 0, len(definitions))
+	for _, def := range definitions {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool {
+		return defs[i].Name < defs[j].Name
+	})
+	return defs
+}
@@ -0,0 +1,233 @@
+// Package ciliumconfig reads the cilium-config ConfigMap and explains how
+// Cilium sized its BPF maps.
+package ciliumconfig
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	Namespace     = "kube-system"
+	ConfigMapName = "cilium-config"
+
+	DynamicSizeRatioKey = "bpf-map-dynamic-size-ratio"
+	CTGlobalTCPMaxKey   = "bpf-ct-global-tcp-max"
+	CTGlobalAnyMaxKey   = "bpf-ct-global-any-max"
+	NATGlobalMaxKey     = "bpf-nat-global-max"
+	NeighGlobalMaxKey   = "bpf-neigh-global-max"
+	LBServiceMapMaxKey  = "bpf-lb-service-map-max"
+	LBBackendMapMaxKey  = "bpf-lb-backend-map-max"
+	LBRevNatMapMaxKey   = "bpf-lb-rev-nat-map-max"
+	LBAffinityMapMaxKey = "bpf-lb-affinity-map-max"
+	FragmentsMapMaxKey  = "bpf-fragments-map-max"
+	PolicyMapMaxKey     = "bpf-policy-map-max"
+
+	PrometheusServeAddrKey = "prometheus-serve-addr"
+	EnableIPv4Key          = "enable-ipv4"
+	EnableIPv6Key          = "enable-ipv6"
+
+	// LimitTableMax is the largest size Cilium accepts for a map, static or dynamic.
+	LimitTableMax = 1 << 24
+)
+
+type SizingMode string
+
+const (
+	Static  SizingMode = "static"
+	Dynamic SizingMode = "dynamic"
+)
+
+// option describes a cilium-agent option that sizes a map.
+type option struct {
+	key          string
+	defaultValue int
+	// dynamic options are derived from bpf-map-dynamic-size-ratio unless
+	// they are set to a value other than their default.
+	dynamic bool
+}
+
+var options = map[string]option{
+	CTGlobalTCPMaxKey:   {key: CTGlobalTCPMaxKey, defaultValue: 2 << 18, dynamic: true},
+	CTGlobalAnyMaxKey:   {key: CTGlobalAnyMaxKey, defaultValue: 2 << 17, dynamic: true},
+	NATGlobalMaxKey:     {key: NATGlobalMaxKey, defaultValue: 2 << 18, dynamic: true},
+	NeighGlobalMaxKey:   {key: NeighGlobalMaxKey, defaultValue: 2 << 18, dynamic: true},
+	LBServiceMapMaxKey:  {key: LBServiceMapMaxKey, defaultValue: 1 << 16},
+	LBBackendMapMaxKey:  {key: LBBackendMapMaxKey, defaultValue: 1 << 16},
+	LBRevNatMapMaxKey:   {key: LBRevNatMapMaxKey, defaultValue: 1 << 16},
+	LBAffinityMapMaxKey: {key: LBAffinityMapMaxKey, defaultValue: 1 << 16},
+	FragmentsMapMaxKey:  {key: FragmentsMapMaxKey, defaultValue: 1 << 13},
+	PolicyMapMaxKey:     {key: PolicyMapMaxKey, defaultValue: 1 << 14},
+}
+
+// mapOption returns the option that sizes a map of the catalog.
+func mapOption(mapName string) (option, bool) {
+	m, ok := bpfmaps.Lookup(mapName)
+	if !ok {
+		return option{}, false
+	}
+	opt, ok := options[m.Option]
+	return opt, ok
+}
+
+// Config is the subset of cilium-config that affects map sizing.
+type Config struct {
+	DynamicSizeRatio float64
+	data             map[string]string
+}
+
+// Load reads the cilium-config ConfigMap.
+func Load(ctx context.Context, kc kubernetes.Interface) (*Config, error) {
+	cm, err := kc.CoreV1().ConfigMaps(Namespace).Get(ctx, ConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configmap %s/%s: %w", Namespace, ConfigMapName, err)
+	}
+	return New(cm.Data)
+}
+
+// New builds a Config from the data of the cilium-config ConfigMap.
+func New(data map[string]string) (*Config, error) {
+	c := &Config{data: data}
+	if value, ok := data[DynamicSizeRatioKey]; ok && value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", DynamicSizeRatioKey, value, err)
+		}
+		c.DynamicSizeRatio = ratio
+	}
+	return c, nil
+}
+
+// Sizing explains how a map got its size and how large it should be.
+type Sizing struct {
+	Mode             SizingMode `json:"mode"`
+	Option           string     `json:"option"`
+	ConfiguredValue  int        `json:"configuredValue,omitempty"`
+	DynamicSizeRatio float64    `json:"dynamicSizeRatio,omitempty"`
+	NodeMemory       int64      `json:"nodeMemory,omitempty"`
+	// RecommendedMaxEntries is the smallest size that keeps the map below the
+	// warning threshold. It is omitted when the map is already below it.
+	RecommendedMaxEntries int `json:"recommendedMaxEntries,omitempty"`
+	// RecommendedRatio is the bpf-map-dynamic-size-ratio that yields
+	// RecommendedMaxEntries for dynamically sized maps.
+	RecommendedRatio float64 `json:"recommendedDynamicSizeRatio,omitempty"`
+	Hint             string  `json:"hint,omitempty"`
+}
+
+// Explain returns the sizing of a map holding currentEntries out of
+// maxEntries, or nil if the map is not sized by a cilium-agent option.
+//
+// Cilium derives the size of the conntrack, NAT and neighbor maps from the node
+// memory when bpf-map-dynamic-size-ratio is set, unless the option of the map is set to a
+// value other than its default. The derived size is linear in the ratio, so
+// the required ratio is scaled from the size observed on the node.
+func (c *Config) Explain(mapName string, maxEntries, currentEntries int, warningRatio float64, nodeMemory int64) *Sizing {
+	opt, ok := mapOption(mapName)
+	if !ok || maxEntries <= 0 {
+		return nil
+	}
+
+	sizing := &Sizing{
+		Mode:       Static,
+		Option:     opt.key,
+		NodeMemory: nodeMemory,
+	}
+
+	configured, explicit := c.intValue(opt.key)
+	if explicit {
+		sizing.ConfiguredValue = configured
+	}
+	if opt.dynamic && c.DynamicSizeRatio > 0 && (!explicit || configured == opt.defaultValue) {
+		sizing.Mode = Dynamic
+		sizing.DynamicSizeRatio = c.DynamicSizeRatio
+	}
+
+	required := RequiredMaxEntries(currentEntries, warningRatio)
+	if required <= maxEntries {
+		return sizing
+	}
+	sizing.RecommendedMaxEntries = required
+
+	switch {
+	case required > LimitTableMax:
+		sizing.Hint = fmt.Sprintf("needs %d entries, more than the maximum map size %d", required, LimitTableMax)
+	case sizing.Mode == Dynamic:
+		sizing.RecommendedRatio = ScaleRatio(c.DynamicSizeRatio, maxEntries, required)
+		sizing.Hint = fmt.Sprintf("increase %s from %g to at least %g", DynamicSizeRatioKey, c.DynamicSizeRatio, sizing.RecommendedRatio)
+	default:
+		sizing.Hint = fmt.Sprintf("increase %s from %d to at least %d", opt.key, maxEntries, required)
+	}
+	return sizing
+}
+
+// MetricsPort returns the port cilium-agent serves its metrics on, or false
+// if the metrics are disabled.
+func (c *Config) MetricsPort() (string, bool) {
+	addr := c.data[PrometheusServeAddrKey]
+	if addr == "" {
+		return "", false
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port == "" {
+		return "", false
+	}
+	return port, true
+}
+
+// FamilyEnabled reports whether cilium-agent creates the maps of an IP
+// family. IPv4 is enabled and IPv6 disabled by default, and when c is nil.
+func (c *Config) FamilyEnabled(family bpfmaps.Family) bool {
+	var key string
+	enabled := true
+	switch family {
+	case bpfmaps.IPv4:
+		key = EnableIPv4Key
+	case bpfmaps.IPv6:
+		key, enabled = EnableIPv6Key, false
+	default:
+		return true
+	}
+	if c == nil {
+		return enabled
+	}
+	if value, err := strconv.ParseBool(c.data[key]); err == nil {
+		enabled = value
+	}
+	return enabled
+}
+
+func (c *Config) intValue(key string) (int, bool) {
+	value, ok := c.data[key]
+	if !ok || value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// RequiredMaxEntries returns the smallest map size at which currentEntries
+// stays below the given usage ratio.
+func RequiredMaxEntries(currentEntries int, ratio float64) int {
+	required := int(float64(currentEntries)/ratio) + 1
+	for required > 0 && currentEntries >= int(float64(required)*ratio) {
+		required++
+	}
+	return required
+}
+
+// ScaleRatio returns the bpf-map-dynamic-size-ratio at which a map that has
+// maxEntries entries at ratio grows to requiredEntries, rounded up to 4 digits.
+func ScaleRatio(ratio float64, maxEntries, requiredEntries int) float64 {
+	const pow = 1e4
+	return math.Ceil(ratio*float64(requiredEntries)/float64(maxEntries)*pow) / pow
+}
@@ -0,0 +1,125 @@
+package ciliumconfig
+
+import (
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+)
+
+func TestExplain(t *testing.T) {
+	c, err := New(map[string]string{
+		DynamicSizeRatioKey: "0.0025",
+		CTGlobalTCPMaxKey:   "524288",
+		CTGlobalAnyMaxKey:   "100000",
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	// Set to the default value: still sized dynamically.
+	ct := c.Explain("cilium_ct4_global", 356212, 300000, 0.8, 16<<30)
+	if ct.Mode != Dynamic || ct.DynamicSizeRatio != 0.0025 || ct.ConfiguredValue != 524288 {
+		t.Errorf("unexpected ct sizing %+v", ct)
+	}
+	if ct.RecommendedMaxEntries != 375002 || ct.RecommendedRatio != 0.0027 || ct.Hint == "" {
+		t.Errorf("unexpected ct recommendation %+v", ct)
+	}
+
+	// Set to a non-default value: static.
+	ctAny := c.Explain("cilium_ct_any4_global", 100000, 90000, 0.8, 16<<30)
+	if ctAny.Mode != Static || ctAny.RecommendedMaxEntries != 112502 || ctAny.RecommendedRatio != 0 {
+		t.Errorf("unexpected ct any sizing %+v", ctAny)
+	}
+
+	// Below the threshold: no recommendation.
+	nat := c.Explain("cilium_snat_v4_external", 356212, 1000, 0.8, 16<<30)
+	if nat.Mode != Dynamic || nat.RecommendedMaxEntries != 0 || nat.Hint != "" {
+		t.Errorf("unexpected nat sizing %+v", nat)
+	}
+
+	if c.Explain("cilium_lxc", 65535, 10, 0.8, 0) != nil {
+		t.Errorf("expected no sizing for a map without an option")
+	}
+}
+
+func TestExplainStaticWithoutRatio(t *testing.T) {
+	c, err := New(map[string]string{})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	s := c.Explain("cilium_nodeport_neigh4", 524288, 524288, 0.8, 0)
+	if s.Mode != Static || s.RecommendedMaxEntries != 655362 {
+		t.Errorf("unexpected sizing %+v", s)
+	}
+}
+
+func TestExplainOverLimit(t *testing.T) {
+	c, _ := New(map[string]string{DynamicSizeRatioKey: "0.01"})
+	s := c.Explain("cilium_ct4_global", 1<<24, 1<<24, 0.8, 0)
+	if s.RecommendedRatio != 0 || s.Hint == "" {
+		t.Errorf("expected no ratio above the map size limit, got %+v", s)
+	}
+}
+
+func TestRequiredMaxEntries(t *testing.T) {
+	for _, current := range []int{0, 1, 799, 800, 284970, 1 << 20} {
+		for _, ratio := range []float64{0.5, 0.7, 0.8, 0.9} {
+			required := RequiredMaxEntries(current, ratio)
+			if current >= int(float64(required)*ratio) {
+				t.Errorf("%d entries at %g: %d is still above the threshold", current, ratio, required)
+			}
+			if current < int(float64(required-1)*ratio) {
+				t.Errorf("%d entries at %g: %d is not minimal", current, ratio, required)
+			}
+		}
+	}
+}
+
+func TestNewInvalidRatio(t *testing.T) {
+	if _, err := New(map[string]string{DynamicSizeRatioKey: "abc"}); err == nil {
+		t.Errorf("expected an error for an invalid ratio")
+	}
+}
+
+func TestExplainLoadBalancerMapsAreStatic(t *testing.T) {
+	c, _ := New(map[string]string{DynamicSizeRatioKey: "0.0025"})
+	s := c.Explain("cilium_lb4_backends_v3", 65536, 60000, 0.8, 16<<30)
+	if s.Mode != Static || s.Option != LBBackendMapMaxKey || s.Hint == "" {
+		t.Errorf("unexpected sizing %+v", s)
+	}
+	if c.Explain("cilium_ipcache", 512000, 10, 0.8, 0) != nil {
+		t.Errorf("expected no sizing for a map with a fixed size")
+	}
+}
+
+func TestCatalogOptionsAreKnown(t *testing.T) {
+	for _, m := range append(bpfmaps.Catalog, bpfmaps.PolicyMap) {
+		if _, ok := options[m.Option]; m.Option != "" && !ok {
+			t.Errorf("map %s is sized by unknown option %s", m.Name, m.Option)
+		}
+	}
+}
+
+func TestMetricsPort(t *testing.T) {
+	for addr, want := range map[string]string{":9962": "9962", "0.0.0.0:9090": "9090", "": "", "9962": ""} {
+		c, err := New(map[string]string{PrometheusServeAddrKey: addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		port, ok := c.MetricsPort()
+		if port != want || ok != (want != "") {
+			t.Errorf("%q: expected port %q, got %q, %v", addr, want, port, ok)
+		}
+	}
+}
+
+func TestFamilyEnabled(t *testing.T) {
+	var defaults *Config
+	if !defaults.FamilyEnabled(bpfmaps.IPv4) || defaults.FamilyEnabled(bpfmaps.IPv6) || !defaults.FamilyEnabled("") {
+		t.Errorf("expected IPv4 only by default")
+	}
+	c, _ := New(map[string]string{EnableIPv4Key: "false", EnableIPv6Key: "true"})
+	if c.FamilyEnabled(bpfmaps.IPv4) || !c.FamilyEnabled(bpfmaps.IPv6) {
+		t.Errorf("expected IPv6 only")
+	}
+}
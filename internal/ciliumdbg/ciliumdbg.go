@@ -0,0 +1,128 @@
+// Package ciliumdbg reads the map sizes and pressure that cilium-agent reports
+// through cilium-dbg, for nodes where bpftool is not available.
+//
+// `cilium-dbg status` reports the configured size of the map groups and
+// `cilium-dbg metrics list` the bpf_map_pressure gauge, the ratio of entries to
+// size, of the maps the agent tracks. Entries are derived from both. Maps
+// without a pressure metric are not reported; policy maps are only reported
+// once they are more than 10% full.
+package ciliumdbg
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/agentmetrics"
+	"github.com/gyutaeb/kubectl-cilium/internal/batch"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+)
+
+// Method is the count method of the stats read through cilium-dbg.
+const Method = "cilium-dbg"
+
+// script prints the status and the metrics of the agent as one JSON document.
+// Older images ship cilium-dbg as cilium.
+const script = `dbg=$(command -v cilium-dbg || command -v cilium) || { echo "cilium-dbg is not installed" >&2; exit 127; }
+status=$("$dbg" status -o json 2>/dev/null)
+metrics=$("$dbg" metrics list -o json 2>/dev/null)
+printf '{"status":%s,"metrics":%s}\n' "${status:-null}" "${metrics:-null}"
+`
+
+// Cmd reads the map sizes and pressure of the agent in a single exec.
+var Cmd = []string{"sh", "-c", script}
+
+// sizeNames maps the pinned maps to the names cilium-agent reports their size
+// under in `cilium-dbg status`. IPv4 and IPv6 variants share a size.
+var sizeNames = map[string]string{
+	"cilium_ct4_global":          "TCP connection tracking",
+	"cilium_ct6_global":          "TCP connection tracking",
+	"cilium_ct_any4_global":      "Non-TCP connection tracking",
+	"cilium_ct_any6_global":      "Non-TCP connection tracking",
+	"cilium_snat_v4_external":    "NAT",
+	"cilium_snat_v6_external":    "NAT",
+	"cilium_nodeport_neigh4":     "Neighbor table",
+	"cilium_nodeport_neigh6":     "Neighbor table",
+	"cilium_lb4_services_v2":     "IPv4 service",
+	"cilium_lb6_services_v2":     "IPv6 service",
+	"cilium_lb4_backends_v3":     "IPv4 service backend",
+	"cilium_lb6_backends_v3":     "IPv6 service backend",
+	"cilium_lb4_reverse_nat":     "IPv4 service reverse NAT",
+	"cilium_lb6_reverse_nat":     "IPv6 service reverse NAT",
+	"cilium_lb4_affinity":        "Session affinity",
+	"cilium_lb6_affinity":        "Session affinity",
+	"cilium_ipv4_frag_datagrams": "IPv4 fragmentation",
+	"cilium_ipv6_frag_datagrams": "IPv6 fragmentation",
+	"cilium_ipcache":             "IP cache",
+	"cilium_lxc":                 "Endpoint policy",
+	"cilium_tunnel_map":          "Tunnel",
+}
+
+func sizeName(mapName string) (string, bool) {
+	if _, ok := bpfmaps.PolicyEndpointID(mapName); ok {
+		return "Global policy", true
+	}
+	name, ok := sizeNames[mapName]
+	return name, ok
+}
+
+type output struct {
+	Status *struct {
+		BPFMaps *struct {
+			Maps []struct {
+				Name string `json:"name"`
+				Size int    `json:"size"`
+			} `json:"maps"`
+		} `json:"bpf-maps"`
+	} `json:"status"`
+	Metrics []struct {
+		Name   string            `json:"name"`
+		Labels map[string]string `json:"labels"`
+		Value  float64           `json:"value"`
+	} `json:"metrics"`
+}
+
+// Parse decodes the output of Cmd into the stats of the maps that have a
+// pressure metric, sorted by name.
+func Parse(out string) ([]batch.Stats, error) {
+	var o output
+	if err := json.Unmarshal([]byte(out), &o); err != nil {
+		return nil, fmt.Errorf("failed to decode cilium-dbg output: %w", err)
+	}
+	if o.Status == nil || o.Status.BPFMaps == nil {
+		return nil, fmt.Errorf("cilium-dbg status printed no BPF map sizes")
+	}
+	if o.Metrics == nil {
+		return nil, fmt.Errorf("cilium-dbg metrics list printed nothing")
+	}
+
+	sizes := map[string]int{}
+	for _, m := range o.Status.BPFMaps.Maps {
+		sizes[m.Name] = m.Size
+	}
+
+	var stats []batch.Stats
+	for _, metric := range o.Metrics {
+		if metric.Name != agentmetrics.PressureMetric || metric.Labels["map_name"] == "" {
+			continue
+		}
+		mapName := agentmetrics.MapName(metric.Labels["map_name"])
+
+		st := batch.Stats{Map: mapName, Method: Method}
+		name, ok := sizeName(mapName)
+		size := sizes[name]
+		if !ok || size <= 0 {
+			st.Err = fmt.Errorf("cilium-dbg status does not report the size of %s", mapName)
+		} else {
+			st.Info = &bpftool.MapInfo{Name: mapName, MaxEntries: size}
+			st.Entries = int(math.Round(metric.Value * float64(size)))
+		}
+		stats = append(stats, st)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Map < stats[j].Map
+	})
+	return stats, nil
+}
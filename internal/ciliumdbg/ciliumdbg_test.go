@@ -0,0 +1,53 @@
+package ciliumdbg
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	out := `{"status":{"bpf-maps":{"dynamic-size-ratio":0.0025,"maps":[
+		{"name":"TCP connection tracking","size":1000},
+		{"name":"NAT","size":2000},
+		{"name":"Global policy","size":16384}]}},
+	"metrics":[
+		{"name":"cilium_bpf_map_pressure","labels":{"map_name":"ct4_global"},"value":0.8},
+		{"name":"cilium_bpf_map_pressure","labels":{"map_name":"snat_v4_external"},"value":0.0005},
+		{"name":"cilium_bpf_map_pressure","labels":{"map_name":"policy_00042"},"value":0.5},
+		{"name":"cilium_bpf_map_pressure","labels":{"map_name":"cilium_calls_00042"},"value":0.1},
+		{"name":"cilium_endpoint_state","labels":{"endpoint_state":"ready"},"value":3}]}`
+
+	stats, err := Parse(out)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(stats) != 4 {
+		t.Fatalf("expected 4 maps, got %+v", stats)
+	}
+
+	calls, ct, policy, snat := stats[0], stats[1], stats[2], stats[3]
+	if ct.Map != "cilium_ct4_global" || ct.Err != nil || ct.Entries != 800 || ct.Info.MaxEntries != 1000 || ct.Method != Method {
+		t.Errorf("unexpected ct stats %+v", ct)
+	}
+	if snat.Map != "cilium_snat_v4_external" || snat.Entries != 1 || snat.Info.MaxEntries != 2000 {
+		t.Errorf("unexpected snat stats %+v", snat)
+	}
+	if policy.Map != "cilium_policy_00042" || policy.Entries != 8192 {
+		t.Errorf("unexpected policy stats %+v", policy)
+	}
+	if calls.Map != "cilium_calls_00042" || calls.Err == nil {
+		t.Errorf("expected an error for a map without size, got %+v", calls)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, out := range []string{
+		"",
+		"cilium-dbg is not installed",
+		`{"status":null,"metrics":[]}`,
+		`{"status":{"bpf-maps":{"maps":[]}},"metrics":null}`,
+	} {
+		if _, err := Parse(out); err == nil {
+			t.Errorf("expected an error for %q", out)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Package ciliumendpoint resolves Cilium endpoint IDs to the pods they belong
+// to from the CiliumEndpoint objects.
+package ciliumendpoint
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// GVR is the resource of the CiliumEndpoint objects.
+var GVR = schema.GroupVersionResource{Group: "cilium.io", Version: "v2", Resource: "ciliumendpoints"}
+
+// Endpoint is a Cilium endpoint. Its name is the name of the pod.
+type Endpoint struct {
+	ID        int    `json:"id"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name,omitempty"`
+	// NodeIP is the IP of the node hosting the endpoint. Endpoint IDs are
+	// only unique per node.
+	NodeIP string `json:"-"`
+}
+
+// Index finds endpoints by node IP and endpoint ID.
+type Index map[string]map[int]Endpoint
+
+// List reads the CiliumEndpoint objects of all namespaces. Objects without an
+// endpoint ID or node IP, e.g. of endpoints still being created, are skipped.
+func List(ctx context.Context, dc dynamic.Interface) (Index, error) {
+	list, err := dc.Resource(GVR).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", GVR.Resource, err)
+	}
+
+	index := Index{}
+	for _, item := range list.Items {
+		ep, ok := fromUnstructured(item)
+		if !ok {
+			continue
+		}
+		if index[ep.NodeIP] == nil {
+			index[ep.NodeIP] = map[int]Endpoint{}
+		}
+		index[ep.NodeIP][ep.ID] = ep
+	}
+	return index, nil
+}
+
+func fromUnstructured(item unstructured.Unstructured) (Endpoint, bool) {
+	id, ok, err := unstructured.NestedInt64(item.Object, "status", "id")
+	if err != nil || !ok {
+		return Endpoint{}, false
+	}
+	nodeIP, ok, err := unstructured.NestedString(item.Object, "status", "networking", "node")
+	if err != nil || !ok || nodeIP == "" {
+		return Endpoint{}, false
+	}
+	return Endpoint{
+		ID:        int(id),
+		Namespace: item.GetNamespace(),
+		Name:      item.GetName(),
+		NodeIP:    nodeIP,
+	}, true
+}
+
+// Lookup returns the endpoint with the given ID on the node with one of the
+// given addresses.
+func (idx Index) Lookup(nodeAddresses []string, id int) (Endpoint, bool) {
+	for _, addr := range nodeAddresses {
+		if ep, ok := idx[addr][id]; ok {
+			return ep, true
+		}
+	}
+	return Endpoint{}, false
+}
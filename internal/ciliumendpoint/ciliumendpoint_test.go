@@ -0,0 +1,122 @@
+package ciliumendpoint
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+// newObject builds a CiliumEndpoint object for tests.
+func newObject(namespace, name string, id int64, nodeIP string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "cilium.io/v2",
+		"kind":       "CiliumEndpoint",
+		"metadata":   map[string]any{"namespace": namespace, "name": name},
+		"status": map[string]any{
+			"id":         id,
+			"networking": map[string]any{"node": nodeIP},
+		},
+	}}
+}
+
+func TestList(t *testing.T) {
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GVR: "CiliumEndpointList"},
+		newObject("default", "nginx", 42, "10.0.0.1"),
+		newObject("kube-system", "coredns", 42, "10.0.0.2"),
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "cilium.io/v2",
+			"kind":       "CiliumEndpoint",
+			"metadata":   map[string]any{"namespace": "default", "name": "pending"},
+		}},
+	)
+
+	index, err := List(context.Background(), dc)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	ep, ok := index.Lookup([]string{"192.168.0.1", "10.0.0.2"}, 42)
+	if !ok || ep.Namespace != "kube-system" || ep.Name != "coredns" {
+		t.Errorf("unexpected endpoint %+v", ep)
+	}
+	if _, ok := index.Lookup([]string{"10.0.0.1"}, 7); ok {
+		t.Errorf("expected no endpoint 7")
+	}
+}
+
+// ciliumEndpoints are CiliumEndpoint objects as returned by the API server,
+// the second one of an endpoint whose node is not known yet.
+const ciliumEndpoints = `{
+  "apiVersion": "cilium.io/v2",
+  "kind": "CiliumEndpointList",
+  "metadata": {"resourceVersion": "1"},
+  "items": [
+    {
+      "apiVersion": "cilium.io/v2",
+      "kind": "CiliumEndpoint",
+      "metadata": {
+        "name": "nginx-7c5ddbdf54-x2k8p",
+        "namespace": "default",
+        "ownerReferences": [{"apiVersion": "v1", "kind": "Pod", "name": "nginx-7c5ddbdf54-x2k8p", "uid": "5f0e1a2b"}]
+      },
+      "status": {
+        "encryption": {},
+        "external-identifiers": {
+          "container-id": "3d4c5b6a",
+          "k8s-namespace": "default",
+          "k8s-pod-name": "nginx-7c5ddbdf54-x2k8p",
+          "pod-name": "default/nginx-7c5ddbdf54-x2k8p"
+        },
+        "id": 1877,
+        "identity": {"id": 24120, "labels": ["k8s:app=nginx", "k8s:io.kubernetes.pod.namespace=default"]},
+        "networking": {
+          "addressing": [{"ipv4": "10.0.1.23"}],
+          "node": "192.168.10.11"
+        },
+        "state": "ready"
+      }
+    },
+    {
+      "apiVersion": "cilium.io/v2",
+      "kind": "CiliumEndpoint",
+      "metadata": {"name": "redis-0", "namespace": "default"},
+      "status": {
+        "id": 1877,
+        "identity": {"id": 31005},
+        "networking": {"addressing": [{"ipv4": "10.0.2.7"}]},
+        "state": "waiting-for-identity"
+      }
+    }
+  ]
+}`
+
+func TestListCiliumEndpoints(t *testing.T) {
+	obj, err := runtime.Decode(unstructured.UnstructuredJSONScheme, []byte(ciliumEndpoints))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	var objects []runtime.Object
+	for _, item := range obj.(*unstructured.UnstructuredList).Items {
+		objects = append(objects, &item)
+	}
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{GVR: "CiliumEndpointList"}, objects...)
+
+	index, err := List(context.Background(), dc)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	ep, ok := index.Lookup([]string{"10.0.1.23", "192.168.10.11"}, 1877)
+	if !ok || ep.Namespace != "default" || ep.Name != "nginx-7c5ddbdf54-x2k8p" || ep.NodeIP != "192.168.10.11" {
+		t.Errorf("unexpected endpoint %+v", ep)
+	}
+	if _, ok := index[""]; ok {
+		t.Errorf("expected the endpoint without a node IP to be skipped, got %+v", index[""])
+	}
+}
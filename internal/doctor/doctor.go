@@ -0,0 +1,323 @@
+// Package doctor runs every registered check in one pass and consolidates
+// their reports into a health verdict per node and a prioritized list of
+// remediation hints.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+)
+
+// ResultAPIVersion is the version of the machine-readable report schema.
+// It is bumped whenever a field is removed or its meaning changes.
+const ResultAPIVersion = "kubectl-cilium/v1alpha1"
+
+const resultKind = "DoctorReport"
+
+// Check is a check run by the doctor, by the name it is registered under.
+type Check struct {
+	Name  string
+	Check check.Check
+}
+
+type checkRun struct {
+	name   string
+	report check.Report
+	err    error
+}
+
+// Doctor runs its checks one after another on the same nodes, so that the
+// checks that come later can reuse the maps the earlier ones read through the
+// map cache of the environment. Only the maps are shared: every check runs its
+// own commands, and the inspector pods or containers of a check are cleaned up
+// before the next one starts.
+type Doctor struct {
+	checks []Check
+	runs   []checkRun
+}
+
+var _ check.Check = (*Doctor)(nil)
+
+func New(checks []Check) *Doctor {
+	return &Doctor{checks: checks}
+}
+
+// Collect runs the checks. A failing check is reported, the others still run.
+// It only fails if every check failed. Once ctx is cancelled, the remaining
+// checks are not started and fail with its error.
+func (d *Doctor) Collect(ctx context.Context, nodes check.NodeFilter) error {
+	d.runs = nil
+	var errs []error
+	for _, c := range d.checks {
+		run := checkRun{name: c.Name}
+		run.err = ctx.Err()
+		if run.err == nil {
+			fmt.Fprintf(os.Stderr, "Running check... %s\n", c.Name)
+			run.err = c.Check.Collect(ctx, nodes)
+		}
+		if run.err != nil {
+			fmt.Fprintf(os.Stderr, "Check %s failed: %v\n", c.Name, run.err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name, run.err))
+		} else {
+			run.report = c.Check.Evaluate()
+		}
+		d.runs = append(d.runs, run)
+	}
+	if len(errs) > 0 && len(errs) == len(d.checks) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func (d *Doctor) Evaluate() check.Report {
+	return d.Result()
+}
+
+// Report is the consolidated outcome of the checks.
+type Report struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Nodes      []NodeVerdict `json:"nodes"`
+	Hints      []Hint        `json:"hints"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+// NodeVerdict is the health of a node over all checks.
+type NodeVerdict struct {
+	Node string `json:"node"`
+	// Status is Critical or Warning if any finding of the node is, Unknown if
+	// some could not be checked, and OK otherwise.
+	Status   check.Status `json:"status"`
+	Critical int          `json:"critical"`
+	Warning  int          `json:"warning"`
+	Unknown  int          `json:"unknown"`
+	// Issue describes the most severe finding of the node.
+	Issue string `json:"issue,omitempty"`
+}
+
+// Hint is a remediation shared by the findings of a check on one or more
+// nodes. Hints are ordered by priority, 1 being the most urgent.
+type Hint struct {
+	Priority int          `json:"priority"`
+	Status   check.Status `json:"status"`
+	Check    string       `json:"check"`
+	Hint     string       `json:"hint"`
+	Nodes    []string     `json:"nodes"`
+	Subjects []string     `json:"subjects"`
+}
+
+// CheckResult is the report of a single check, in its own schema.
+type CheckResult struct {
+	Name   string       `json:"name"`
+	Error  string       `json:"error,omitempty"`
+	Result check.Report `json:"result,omitempty"`
+}
+
+// verdictOrder ranks the node verdicts. Unlike check.Status.Rank, a node that
+// could not be fully checked comes before a healthy one.
+var verdictOrder = map[check.Status]int{
+	check.Critical: 0,
+	check.Warning:  1,
+	check.Unknown:  2,
+	check.OK:       3,
+}
+
+type finding struct {
+	name string
+	check.Finding
+}
+
+// Result returns the consolidated outcome of the last Collect.
+func (d *Doctor) Result() *Report {
+	report := &Report{
+		APIVersion: ResultAPIVersion,
+		Kind:       resultKind,
+		Nodes:      []NodeVerdict{},
+		Hints:      []Hint{},
+		Checks:     []CheckResult{},
+	}
+
+	var findings []finding
+	for _, run := range d.runs {
+		result := CheckResult{Name: run.name, Result: run.report}
+		if run.err != nil {
+			result.Error = run.err.Error()
+		} else {
+			for _, f := range run.report.Findings() {
+				findings = append(findings, finding{name: run.name, Finding: f})
+			}
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	report.Nodes = verdicts(findings)
+	report.Hints = hints(findings)
+	return report
+}
+
+func verdicts(findings []finding) []NodeVerdict {
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Status != b.Status {
+			return verdictOrder[a.Status] < verdictOrder[b.Status]
+		}
+		return a.Usage > b.Usage
+	})
+
+	byNode := map[string]*NodeVerdict{}
+	for _, f := range findings {
+		v, ok := byNode[f.Node]
+		if !ok {
+			v = &NodeVerdict{Node: f.Node, Status: f.Status}
+			if f.Status != check.OK {
+				v.Issue = describe(f)
+			}
+			byNode[f.Node] = v
+		}
+		switch f.Status {
+		case check.Critical:
+			v.Critical++
+		case check.Warning:
+			v.Warning++
+		case check.Unknown:
+			v.Unknown++
+		}
+	}
+
+	nodes := make([]NodeVerdict, 0, len(byNode))
+	for _, v := range byNode {
+		nodes = append(nodes, *v)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Status != b.Status {
+			return verdictOrder[a.Status] < verdictOrder[b.Status]
+		}
+		return a.Node < b.Node
+	})
+	return nodes
+}
+
+// describe summarizes a finding that is not OK.
+func describe(f finding) string {
+	if f.Status == check.Unknown {
+		return fmt.Sprintf("%s: %s: %s", f.name, f.Subject, f.Error)
+	}
+	return fmt.Sprintf("%s: %s at %.2f%%", f.name, f.Subject, f.Usage)
+}
+
+// hints groups the hints of the findings by check and hint, most severe
+// first, then those affecting the most nodes.
+func hints(findings []finding) []Hint {
+	type key struct{ check, hint string }
+	byKey := map[key]*Hint{}
+	var order []key
+	for _, f := range findings {
+		if f.Hint == "" || f.Status != check.Critical && f.Status != check.Warning {
+			continue
+		}
+		k := key{f.name, f.Hint}
+		h, ok := byKey[k]
+		if !ok {
+			h = &Hint{Status: f.Status, Check: f.name, Hint: f.Hint}
+			byKey[k] = h
+			order = append(order, k)
+		}
+		if f.Status.Rank() < h.Status.Rank() {
+			h.Status = f.Status
+		}
+		if !slices.Contains(h.Nodes, f.Node) {
+			h.Nodes = append(h.Nodes, f.Node)
+		}
+		if !slices.Contains(h.Subjects, f.Subject) {
+			h.Subjects = append(h.Subjects, f.Subject)
+		}
+	}
+
+	result := make([]Hint, 0, len(order))
+	for _, k := range order {
+		h := byKey[k]
+		sort.Strings(h.Nodes)
+		sort.Strings(h.Subjects)
+		result = append(result, *h)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Status != b.Status {
+			return a.Status.Rank() < b.Status.Rank()
+		}
+		if len(a.Nodes) != len(b.Nodes) {
+			return len(a.Nodes) > len(b.Nodes)
+		}
+		return a.Check < b.Check
+	})
+	for i := range result {
+		result[i].Priority = i + 1
+	}
+	return result
+}
+
+// Findings returns the findings of all checks, with the subjects prefixed by
+// their check, and an Unknown finding for every check that failed.
+func (r *Report) Findings() []check.Finding {
+	var findings []check.Finding
+	for _, result := range r.Checks {
+		if result.Error != "" {
+			findings = append(findings, check.Finding{Subject: result.Name, Status: check.Unknown, Error: result.Error})
+			continue
+		}
+		for _, f := range result.Result.Findings() {
+			f.Subject = result.Name + "/" + f.Subject
+			findings = append(findings, f)
+		}
+	}
+	return findings
+}
+
+// Table renders a verdict per node, or every finding in the wide format,
+// followed by the failed checks and the remediation hints.
+func (r *Report) Table(wide bool) check.Table {
+	t := check.Table{Header: []string{"STATUS", "NODE", "CRITICAL", "WARNING", "UNKNOWN", "ISSUE"}}
+	if wide {
+		t.Header = []string{"STATUS", "NODE", "CHECK", "SUBJECT", "USAGE", "DETAIL"}
+		for _, result := range r.Checks {
+			if result.Error != "" {
+				continue
+			}
+			for _, f := range result.Result.Findings() {
+				detail := f.Hint
+				if f.Status == check.Unknown {
+					detail = "ERR:" + f.Error
+				} else if f.Status == check.OK {
+					detail = ""
+				}
+				t.Rows = append(t.Rows, []string{f.Status.Label(), f.Node, result.Name, f.Subject, fmt.Sprintf("%.2f%%", f.Usage), detail})
+			}
+		}
+	} else {
+		for _, v := range r.Nodes {
+			t.Rows = append(t.Rows, []string{v.Status.Label(), v.Node, fmt.Sprint(v.Critical), fmt.Sprint(v.Warning), fmt.Sprint(v.Unknown), v.Issue})
+		}
+	}
+
+	for _, result := range r.Checks {
+		if result.Error != "" {
+			t.Notes = append(t.Notes, fmt.Sprintf("\nCheck %s failed: %s\n", result.Name, result.Error))
+		}
+	}
+	if len(r.Hints) > 0 {
+		note := "\n\033[38;5;208mRemediation, most urgent first:\n"
+		for _, h := range r.Hints {
+			note += fmt.Sprintf("  %d. %s %s on %s: %s\n", h.Priority, h.Status.Label(), h.Check, strings.Join(h.Nodes, ", "), h.Hint)
+		}
+		t.Notes = append(t.Notes, note+"\033[0m\n")
+	}
+	return t
+}
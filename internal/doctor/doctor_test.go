@@ -0,0 +1,151 @@
+package doctor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+)
+
+type fakeReport struct {
+	Items []check.Finding `json:"items"`
+}
+
+func (r *fakeReport) Findings() []check.Finding {
+	return r.Items
+}
+
+func (r *fakeReport) Table(wide bool) check.Table {
+	return check.Table{}
+}
+
+type fakeCheck struct {
+	findings []check.Finding
+	err      error
+	nodes    check.NodeFilter
+}
+
+func (c *fakeCheck) Collect(ctx context.Context, nodes check.NodeFilter) error {
+	c.nodes = nodes
+	return c.err
+}
+
+func (c *fakeCheck) Evaluate() check.Report {
+	return &fakeReport{Items: c.findings}
+}
+
+func TestResult(t *testing.T) {
+	pressure := &fakeCheck{findings: []check.Finding{
+		{Node: "node-1", Subject: "cilium_ct4_global", Status: check.Warning, Usage: 85, Hint: "raise bpf-ct-global-tcp-max"},
+		{Node: "node-2", Subject: "cilium_ct4_global", Status: check.Warning, Usage: 81, Hint: "raise bpf-ct-global-tcp-max"},
+		{Node: "node-2", Subject: "cilium_lb4_services_v2", Status: check.OK, Usage: 1},
+		{Node: "node-3", Subject: "cilium_ct4_global", Status: check.Unknown, Error: "connection reset"},
+		{Node: "node-4", Subject: "cilium_ct4_global", Status: check.OK, Usage: 10},
+	}}
+	snat := &fakeCheck{findings: []check.Finding{
+		{Node: "node-1", Subject: "cilium_snat_v4_external", Status: check.OK, Usage: 20},
+		{Node: "node-2", Subject: "cilium_snat_v4_external", Status: check.Critical, Usage: 95, Hint: "drain and reboot the node"},
+	}}
+	d := New([]Check{{Name: "bpf-map-pressure", Check: pressure}, {Name: "snat-eviction", Check: snat}})
+
+	if err := d.Collect(context.Background(), check.NodeFilter{Names: []string{"node-1"}}); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if !slices.Equal(pressure.nodes.Names, []string{"node-1"}) || !slices.Equal(snat.nodes.Names, []string{"node-1"}) {
+		t.Errorf("expected the node filter to be passed to every check")
+	}
+
+	report := d.Result()
+	want := []NodeVerdict{
+		{Node: "node-2", Status: check.Critical, Critical: 1, Warning: 1, Issue: "snat-eviction: cilium_snat_v4_external at 95.00%"},
+		{Node: "node-1", Status: check.Warning, Warning: 1, Issue: "bpf-map-pressure: cilium_ct4_global at 85.00%"},
+		{Node: "node-3", Status: check.Unknown, Unknown: 1, Issue: "bpf-map-pressure: cilium_ct4_global: connection reset"},
+		{Node: "node-4", Status: check.OK},
+	}
+	if !slices.Equal(report.Nodes, want) {
+		t.Errorf("expected verdicts %+v, got %+v", want, report.Nodes)
+	}
+
+	if len(report.Hints) != 2 {
+		t.Fatalf("expected 2 hints, got %+v", report.Hints)
+	}
+	if h := report.Hints[0]; h.Priority != 1 || h.Check != "snat-eviction" || !slices.Equal(h.Nodes, []string{"node-2"}) {
+		t.Errorf("expected the Critical SNAT hint first, got %+v", h)
+	}
+	if h := report.Hints[1]; h.Priority != 2 || h.Status != check.Warning || !slices.Equal(h.Nodes, []string{"node-1", "node-2"}) || !slices.Equal(h.Subjects, []string{"cilium_ct4_global"}) {
+		t.Errorf("expected the ct hint for both nodes, got %+v", h)
+	}
+
+	statuses := check.Statuses(report)
+	if len(statuses) != 7 || !slices.Contains(statuses, check.Critical) {
+		t.Errorf("expected the findings of both checks, got %v", statuses)
+	}
+}
+
+func TestFailedCheck(t *testing.T) {
+	d := New([]Check{
+		{Name: "bpf-map-pressure", Check: &fakeCheck{err: errors.New("no nodes found")}},
+		{Name: "snat-eviction", Check: &fakeCheck{findings: []check.Finding{{Node: "node-1", Subject: "cilium_snat_v4_external", Status: check.OK}}}},
+	})
+
+	out := &bytes.Buffer{}
+	report, err := check.Run(context.Background(), d, check.NodeFilter{}, out, output.Table)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if statuses := check.Statuses(report); !slices.Equal(statuses, []check.Status{check.Unknown, check.OK}) {
+		t.Errorf("expected the failed check to be Unknown, got %v", statuses)
+	}
+	if !strings.Contains(out.String(), "Check bpf-map-pressure failed: no nodes found") || !strings.Contains(out.String(), "node-1") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := check.Render(out, output.JSON, report); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out.String(), `"kind": "DoctorReport"`) || !strings.Contains(out.String(), `"error": "no nodes found"`) {
+		t.Errorf("unexpected JSON output:\n%s", out.String())
+	}
+
+	d = New([]Check{{Name: "snat-eviction", Check: &fakeCheck{err: errors.New("forbidden")}}})
+	if err := d.Collect(context.Background(), check.NodeFilter{}); err == nil {
+		t.Error("expected an error when every check fails")
+	}
+}
+
+// interruptingCheck cancels the run while it collects, like a signal would.
+type interruptingCheck struct {
+	cancel context.CancelFunc
+}
+
+func (c *interruptingCheck) Collect(ctx context.Context, nodes check.NodeFilter) error {
+	c.cancel()
+	return ctx.Err()
+}
+
+func (c *interruptingCheck) Evaluate() check.Report {
+	return &fakeReport{}
+}
+
+func TestInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pressure := &interruptingCheck{cancel: cancel}
+	snat := &fakeCheck{}
+	d := New([]Check{{Name: "bpf-map-pressure", Check: pressure}, {Name: "snat-eviction", Check: snat}})
+
+	if err := d.Collect(ctx, check.NodeFilter{Names: []string{"node-1"}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the interruption, got %v", err)
+	}
+	if snat.nodes.Names != nil {
+		t.Error("expected the SNAT check not to run once interrupted")
+	}
+	if checks := d.Result().Checks; len(checks) != 2 || checks[1].Error != context.Canceled.Error() {
+		t.Errorf("expected the skipped check to be reported, got %+v", checks)
+	}
+}
@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+)
+
+// CommandExecutor runs a command in a container of a pod and returns its
+// stdout with surrounding whitespace trimmed.
+type CommandExecutor interface {
+	Exec(ctx context.Context, pod *corev1.Pod, container string, cmd []string) (string, error)
+}
+
+// SPDYExecutor executes commands through the pods/exec subresource of the API server.
+type SPDYExecutor struct {
+	kc      kubernetes.Interface
+	restCfg *rest.Config
+}
+
+func NewSPDYExecutor(kc kubernetes.Interface, restCfg *rest.Config) *SPDYExecutor {
+	return &SPDYExecutor{
+		kc:      kc,
+		restCfg: restCfg,
+	}
+}
+
+func (e *SPDYExecutor) Exec(ctx context.Context, pod *corev1.Pod, container string, cmd []string) (string, error) {
+	req := e.kc.CoreV1().RESTClient().Post().Namespace(pod.Namespace).Resource("pods").
+		Name(pod.Name).SubResource("exec").VersionedParams(&corev1.PodExecOptions{
+		Container: container,
+		Command:   cmd,
+		Stdout:    true,
+		Stderr:    true,
+	}, scheme.ParameterCodec)
+
+	exec, err := remotecommand.NewSPDYExecutor(e.restCfg, "POST", req.URL())
+	if err != nil {
+		return "", fmt.Errorf("failed to create executor for pod %s: %w", pod.Name, err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// ExitCode returns the exit code of a command that ran and failed.
+// The second return value is false if err is not caused by a non-zero exit code.
+func ExitCode(err error) (int, bool) {
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,66 @@
+package fake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/exec"
+)
+
+// Call records a single command executed through the fake Executor.
+type Call struct {
+	Namespace string
+	Pod       string
+	Container string
+	Cmd       []string
+}
+
+// Executor is a CommandExecutor that never talks to a cluster.
+// Handler produces the output of each command; when it is nil every command
+// succeeds with empty output.
+type Executor struct {
+	Handler func(pod *corev1.Pod, container string, cmd []string) (string, error)
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+func (e *Executor) Exec(ctx context.Context, pod *corev1.Pod, container string, cmd []string) (string, error) {
+	e.mu.Lock()
+	e.calls = append(e.calls, Call{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		Cmd:       cmd,
+	})
+	e.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if e.Handler == nil {
+		return "", nil
+	}
+	return e.Handler(pod, container, cmd)
+}
+
+// Calls returns the commands executed so far.
+func (e *Executor) Calls() []Call {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	calls := make([]Call, len(e.calls))
+	copy(calls, e.calls)
+	return calls
+}
+
+// ExitError returns the error a real executor reports for a command that
+// exited with the given code.
+func ExitError(code int) error {
+	return exec.CodeExitError{
+		Err:  fmt.Errorf("command terminated with exit code %d", code),
+		Code: code,
+	}
+}
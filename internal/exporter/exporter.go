@@ -0,0 +1,183 @@
+// Package exporter serves the BPF map pressure of the nodes as Prometheus
+// metrics, so that alerts use the same collection as the CLI.
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+)
+
+const (
+	namespace = "kubectl_cilium_bpf_map"
+
+	contentType     = "text/plain; version=0.0.4; charset=utf-8"
+	shutdownTimeout = 10 * time.Second
+)
+
+// Source scans the maps of the nodes. It is implemented by *pressure.Session.
+type Source interface {
+	Scan() *pressure.Result
+	Done() <-chan struct{}
+}
+
+type mapKey struct {
+	node string
+	name string
+}
+
+// Exporter holds the metrics of the last scan and the error counts of all scans.
+type Exporter struct {
+	mu         sync.RWMutex
+	result     *pressure.Result
+	scanErrors map[mapKey]int
+}
+
+func New() *Exporter {
+	return &Exporter{
+		result:     &pressure.Result{},
+		scanErrors: make(map[mapKey]int),
+	}
+}
+
+// Update replaces the metrics with the outcome of a scan. Maps that could not
+// be scanned are counted as scan errors and dropped from the gauges.
+func (e *Exporter) Update(result *pressure.Result) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.result = result
+	for _, item := range result.Items {
+		key := mapKey{node: item.Node, name: item.Map}
+		if _, ok := e.scanErrors[key]; !ok {
+			e.scanErrors[key] = 0
+		}
+		if item.Status == check.Unknown {
+			e.scanErrors[key]++
+		}
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	e.Write(w)
+}
+
+// Write writes the metrics in the Prometheus text exposition format.
+func (e *Exporter) Write(w io.Writer) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	var scanned []pressure.MapResult
+	for _, item := range e.result.Items {
+		if item.Status != check.Unknown {
+			scanned = append(scanned, item)
+		}
+	}
+	sort.Slice(scanned, func(i, j int) bool {
+		if scanned[i].Node != scanned[j].Node {
+			return scanned[i].Node < scanned[j].Node
+		}
+		return scanned[i].Map < scanned[j].Map
+	})
+
+	// Maps read from the metrics of the agent only have a usage.
+	writeHeader(w, "entries", "gauge", "Number of entries in the BPF map.")
+	for _, item := range scanned {
+		if item.MaxEntries > 0 {
+			writeSample(w, "entries", item.Node, item.Map, float64(item.CurrentEntries))
+		}
+	}
+	writeHeader(w, "max_entries", "gauge", "Maximum number of entries of the BPF map.")
+	for _, item := range scanned {
+		if item.MaxEntries > 0 {
+			writeSample(w, "max_entries", item.Node, item.Map, float64(item.MaxEntries))
+		}
+	}
+	writeHeader(w, "usage_ratio", "gauge", "Ratio of the entries to the maximum number of entries of the BPF map.")
+	for _, item := range scanned {
+		writeSample(w, "usage_ratio", item.Node, item.Map, item.Usage/100)
+	}
+
+	keys := make([]mapKey, 0, len(e.scanErrors))
+	for key := range e.scanErrors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].node != keys[j].node {
+			return keys[i].node < keys[j].node
+		}
+		return keys[i].name < keys[j].name
+	})
+	writeHeader(w, "scan_errors_total", "counter", "Number of scans that failed to read the BPF map.")
+	for _, key := range keys {
+		writeSample(w, "scan_errors_total", key.node, key.name, float64(e.scanErrors[key]))
+	}
+}
+
+func writeHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", namespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", namespace, name, metricType)
+}
+
+func writeSample(w io.Writer, name, node, mapName string, value float64) {
+	fmt.Fprintf(w, "%s_%s{node=\"%s\",map=\"%s\"} %g\n", namespace, name, escapeLabel(node), escapeLabel(mapName), value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// Serve scans the maps every interval and serves the metrics on /metrics of
+// addr until the source is interrupted.
+func Serve(src Source, addr string, interval time.Duration) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	e := New()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", e)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: shutdownTimeout}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(ln)
+	}()
+	fmt.Fprintf(os.Stderr, "Serving metrics on %s/metrics\n", ln.Addr())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result := src.Scan()
+		select {
+		case <-src.Done():
+		default:
+			e.Update(result)
+		}
+
+		select {
+		case <-src.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			return srv.Shutdown(ctx)
+		case err := <-serveErr:
+			return fmt.Errorf("failed to serve metrics: %w", err)
+		case <-ticker.C:
+		}
+	}
+}
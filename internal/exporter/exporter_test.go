@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+)
+
+func TestMetrics(t *testing.T) {
+	e := New()
+	e.Update(&pressure.Result{Items: []pressure.MapResult{
+		{Node: "node-1", Map: "cilium_ct4_global", CurrentEntries: 850, MaxEntries: 1000, Usage: 85, Status: "Warning"},
+		{Node: "node-2", Map: "cilium_ct4_global", Status: "Unknown"},
+	}})
+	e.Update(&pressure.Result{Items: []pressure.MapResult{
+		{Node: "node-1", Map: "cilium_ct4_global", CurrentEntries: 900, MaxEntries: 1000, Usage: 90, Status: "Critical"},
+		{Node: "node-2", Map: "cilium_ct4_global", Status: "Unknown"},
+	}})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	if got := rec.Header().Get("Content-Type"); got != contentType {
+		t.Errorf("unexpected content type %q", got)
+	}
+	for _, want := range []string{
+		"# TYPE kubectl_cilium_bpf_map_entries gauge\n",
+		`kubectl_cilium_bpf_map_entries{node="node-1",map="cilium_ct4_global"} 900`,
+		`kubectl_cilium_bpf_map_max_entries{node="node-1",map="cilium_ct4_global"} 1000`,
+		`kubectl_cilium_bpf_map_usage_ratio{node="node-1",map="cilium_ct4_global"} 0.9`,
+		"# TYPE kubectl_cilium_bpf_map_scan_errors_total counter\n",
+		`kubectl_cilium_bpf_map_scan_errors_total{node="node-1",map="cilium_ct4_global"} 0`,
+		`kubectl_cilium_bpf_map_scan_errors_total{node="node-2",map="cilium_ct4_global"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `kubectl_cilium_bpf_map_entries{node="node-2"`) {
+		t.Errorf("expected no gauges for a map that could not be scanned\n%s", body)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	if got := escapeLabel("a\"b\\c\nd"); got != `a\"b\\c\nd` {
+		t.Errorf("unexpected escaped label %q", got)
+	}
+}
+
+type fakeSource struct {
+	mu    sync.Mutex
+	scans int
+	stop  int
+	done  chan struct{}
+}
+
+func (f *fakeSource) Scan() *pressure.Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.scans++
+	if f.scans == f.stop {
+		close(f.done)
+	}
+	return &pressure.Result{}
+}
+
+func (f *fakeSource) Done() <-chan struct{} {
+	return f.done
+}
+
+func TestServeStopsWithSource(t *testing.T) {
+	src := &fakeSource{stop: 3, done: make(chan struct{})}
+	if err := Serve(src, "127.0.0.1:0", time.Millisecond); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if src.scans != 3 {
+		t.Errorf("expected 3 scans, got %d", src.scans)
+	}
+}
+
+func TestServeListenError(t *testing.T) {
+	if err := Serve(&fakeSource{done: make(chan struct{})}, "invalid-address", time.Second); err == nil {
+		t.Errorf("expected an error for an invalid address")
+	}
+}
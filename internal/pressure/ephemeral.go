@@ -0,0 +1,181 @@
+package pressure
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Ephemeral containers cannot be removed from a pod, so they run until they
+// are told to exit by stopEphemeralCmd. The PID file avoids signalling the
+// processes of other containers if the pod shares its process namespace.
+const ephemeralPIDFile = "/tmp/bpf-inspector.pid"
+
+var (
+	ephemeralCmd     = []string{"sh", "-c", "echo $$ > " + ephemeralPIDFile + "; trap 'exit 0' TERM; sleep infinity & wait"}
+	stopEphemeralCmd = []string{"sh", "-c", "kill $(cat " + ephemeralPIDFile + ")"}
+)
+
+// ensureEphemeralContainer adds an inspector container to the cilium-agent
+// pod. A container added earlier by this scanner, or left running by an
+// earlier run, is reused instead.
+func (s *Scanner) ensureEphemeralContainer(parentCtx context.Context, agentPod *corev1.Pod) (*target, error) {
+	nodeName := agentPod.Spec.NodeName
+	s.mu.RLock()
+	t, ok := s.ephemeral[nodeName]
+	s.mu.RUnlock()
+	if ok {
+		return t, nil
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, k8sTimeout)
+	defer cancel()
+
+	pods := s.env.Client.CoreV1().Pods(agentPod.Namespace)
+	pod, err := pods.Get(ctx, agentPod.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cilium-agent pod: %w", err)
+	}
+	if name := runningEphemeralContainer(pod); name != "" {
+		fmt.Fprintf(s.progress, "Reusing ephemeral container: %s in pod %s\n", name, pod.Name)
+		return s.addEphemeralTarget(nodeName, &target{pod: pod, container: name}), nil
+	}
+
+	volumeName := bpffsVolume(pod)
+	if volumeName == "" {
+		return nil, fmt.Errorf("pod %s has no volume for %s", pod.Name, bpffsMountPath)
+	}
+
+	privileged := true
+	name := fmt.Sprintf("%s-%d", podNamePrefix, time.Now().Unix())
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:            name,
+			Image:           s.opts.Inspector.Image,
+			ImagePullPolicy: s.opts.Inspector.ImagePullPolicy,
+			Command:         ephemeralCmd,
+			SecurityContext: &corev1.SecurityContext{
+				Privileged: &privileged,
+				Capabilities: &corev1.Capabilities{
+					Add: inspectorCapabilities,
+				},
+			},
+			VolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      volumeName,
+					MountPath: bpffsMountPath,
+					ReadOnly:  true,
+				},
+			},
+		},
+	})
+
+	_, err = pods.UpdateEphemeralContainers(ctx, pod.Name, pod, metav1.UpdateOptions{})
+	if errors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to add ephemeral container, the cluster does not support ephemeral containers: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to add ephemeral container: %w", err)
+	}
+	fmt.Fprintf(s.progress, "Added ephemeral container: %s to pod %s\n", name, pod.Name)
+
+	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, k8sTimeout, true, func(ctx context.Context) (bool, error) {
+		pod, err = pods.Get(ctx, pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("failed to get cilium-agent pod: %w", err)
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+			if status.State.Terminated != nil {
+				return false, fmt.Errorf("ephemeral container %s terminated: %s", name, status.State.Terminated.Reason)
+			}
+			if status.State.Running != nil {
+				return true, nil
+			}
+			return false, imagePullError(pod.Status.EphemeralContainerStatuses, name)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to wait for ephemeral container to be running: %w", err)
+	}
+
+	return s.addEphemeralTarget(nodeName, &target{pod: pod, container: name}), nil
+}
+
+func (s *Scanner) addEphemeralTarget(nodeName string, t *target) *target {
+	s.mu.Lock()
+	s.ephemeral[nodeName] = t
+	s.mu.Unlock()
+	return t
+}
+
+// runningEphemeralContainer returns an inspector container that is still
+// running in the pod, e.g. after kubectl-cilium was killed before cleanup.
+func runningEphemeralContainer(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.EphemeralContainers {
+		if !strings.HasPrefix(container.Name, podNamePrefix+"-") || !slices.Equal(container.Command, ephemeralCmd) {
+			continue
+		}
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name == container.Name && status.State.Running != nil {
+				return container.Name
+			}
+		}
+	}
+	return ""
+}
+
+// bpffsVolume returns the volume the cilium-agent container mounts the BPF
+// filesystem from, or else a host path volume of the BPF filesystem.
+func bpffsVolume(pod *corev1.Pod) string {
+	for _, container := range pod.Spec.Containers {
+		if container.Name != check.AgentContainer {
+			continue
+		}
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath == bpffsMountPath {
+				return mount.Name
+			}
+		}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil && path.Clean(volume.HostPath.Path) == bpffsMountPath {
+			return volume.Name
+		}
+	}
+	return ""
+}
+
+// stopEphemeralContainers stops the ephemeral containers added by this
+// scanner. They stay listed in the pods until the pods are recreated.
+func (s *Scanner) stopEphemeralContainers() {
+	s.mu.Lock()
+	targets := s.ephemeral
+	s.ephemeral = make(map[string]*target)
+	s.mu.Unlock()
+
+	for _, t := range targets {
+		ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+		_, err := s.env.Executor.Exec(ctx, t.pod, t.container, stopEphemeralCmd)
+		cancel()
+		if err != nil {
+			fmt.Fprintf(s.progress, "failed to stop ephemeral container %s in pod %s: %v\n", t.container, t.pod.Name, err)
+		}
+	}
+	if len(targets) > 0 {
+		fmt.Fprintln(s.progress, "\033[33mAll ephemeral containers stopped.\033[0m")
+	}
+}
@@ -0,0 +1,207 @@
+package pressure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	defaultInspectorImage = "gyutaeb/bpftool:v7.5.0"
+	defaultCPURequest     = "0"
+	defaultCPULimit       = "200m"
+)
+
+// Inspector configures the inspector pods. The ephemeral containers only use
+// the image and its pull policy, as they cannot have resources and share the
+// pull secrets, priority and scheduling of the cilium-agent pod.
+//
+// Example file:
+//
+//	image: registry.example.com/bpftool:v7.5.0
+//	imagePullPolicy: IfNotPresent
+//	imagePullSecrets: [kube-system/regcred]
+//	resources:
+//	  limits:
+//	    memory: 128Mi
+//	priorityClassName: system-node-critical
+//	tolerations:
+//	- key: dedicated
+//	  operator: Exists
+//	nodeSelector:
+//	  kubernetes.io/os: linux
+type Inspector struct {
+	Image           string            `json:"image,omitempty"`
+	ImagePullPolicy corev1.PullPolicy `json:"imagePullPolicy,omitempty"`
+	// ImagePullSecrets are secrets as namespace/name, or as name in the
+	// namespace of Cilium. They are copied into the inspector namespace,
+	// which is deleted with them after the scan.
+	ImagePullSecrets []string `json:"imagePullSecrets,omitempty"`
+	// Resources are merged into the default CPU request and limit.
+	Resources         corev1.ResourceRequirements `json:"resources,omitempty"`
+	PriorityClassName string                      `json:"priorityClassName,omitempty"`
+	// Tolerations replace the default toleration of all taints.
+	Tolerations  []corev1.Toleration `json:"tolerations,omitempty"`
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+}
+
+func DefaultInspector() Inspector {
+	return Inspector{
+		Image: defaultInspectorImage,
+		Resources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(defaultCPURequest)},
+			Limits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(defaultCPULimit)},
+		},
+	}
+}
+
+// LoadInspectorFile reads a YAML or JSON inspector file. Unset fields keep
+// their defaults.
+func LoadInspectorFile(filename string) (Inspector, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return Inspector{}, fmt.Errorf("failed to read inspector file: %w", err)
+	}
+
+	inspector := DefaultInspector()
+	if err := yaml.UnmarshalStrict(b, &inspector); err != nil {
+		return Inspector{}, fmt.Errorf("failed to parse inspector file %s: %w", filename, err)
+	}
+	return inspector, inspector.Validate()
+}
+
+var pullPolicies = []corev1.PullPolicy{corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever}
+
+func (i Inspector) Validate() error {
+	if i.Image == "" {
+		return errors.New("inspector image must not be empty")
+	}
+	if i.ImagePullPolicy != "" && !slices.Contains(pullPolicies, i.ImagePullPolicy) {
+		return fmt.Errorf("unknown image pull policy %q, must be one of %s", i.ImagePullPolicy, joinNames(pullPolicies))
+	}
+	for name, limit := range i.Resources.Limits {
+		if request, ok := i.Resources.Requests[name]; ok && request.Cmp(limit) > 0 {
+			return fmt.Errorf("inspector %s request %s exceeds its limit %s", name, request.String(), limit.String())
+		}
+	}
+	names := map[string]string{}
+	for _, secret := range i.ImagePullSecrets {
+		_, name := pullSecretRef(secret)
+		if name == "" {
+			return fmt.Errorf("invalid image pull secret %q, must be [namespace/]name", secret)
+		}
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("image pull secrets %q and %q have the same name", other, secret)
+		}
+		names[name] = secret
+	}
+	for _, toleration := range i.Tolerations {
+		if toleration.Operator == corev1.TolerationOpExists && toleration.Value != "" {
+			return fmt.Errorf("toleration of %q with operator Exists must not have a value", toleration.Key)
+		}
+	}
+	return nil
+}
+
+// pullSecretRef splits an image pull secret into its namespace and name.
+func pullSecretRef(secret string) (namespace, name string) {
+	namespace, name, ok := strings.Cut(secret, "/")
+	if !ok {
+		return ciliumconfig.Namespace, secret
+	}
+	return namespace, name
+}
+
+// copyPullSecrets copies the image pull secrets into the inspector namespace.
+func (s *Scanner) copyPullSecrets(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, k8sTimeout)
+	defer cancel()
+
+	for _, ref := range s.opts.Inspector.ImagePullSecrets {
+		namespace, name := pullSecretRef(ref)
+		secret, err := s.env.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get image pull secret %s: %w", ref, err)
+		}
+		inspectorSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inspectNS},
+			Type:       secret.Type,
+			Data:       secret.Data,
+		}
+		_, err = s.env.Client.CoreV1().Secrets(inspectNS).Create(ctx, inspectorSecret, metav1.CreateOptions{})
+		if err != nil && !apierrors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to copy image pull secret %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+var taintEffects = []corev1.TaintEffect{corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute}
+
+// ParseToleration parses a toleration in the taint syntax of kubectl,
+// key[=value][:effect]. Without a value the key is tolerated with any value,
+// and without an effect the toleration matches all effects.
+func ParseToleration(s string) (corev1.Toleration, error) {
+	spec, effect, hasEffect := strings.Cut(s, ":")
+	key, value, hasValue := strings.Cut(spec, "=")
+	if key == "" {
+		return corev1.Toleration{}, fmt.Errorf("invalid toleration %q, must be key[=value][:effect]", s)
+	}
+
+	toleration := corev1.Toleration{Key: key, Operator: corev1.TolerationOpExists}
+	if hasValue {
+		toleration.Operator, toleration.Value = corev1.TolerationOpEqual, value
+	}
+	if hasEffect {
+		toleration.Effect = corev1.TaintEffect(effect)
+		if !slices.Contains(taintEffects, toleration.Effect) {
+			return corev1.Toleration{}, fmt.Errorf("invalid toleration %q, effect must be one of %s", s, joinNames(taintEffects))
+		}
+	}
+	return toleration, nil
+}
+
+// errImagePull reports that the inspector image cannot be pulled, which
+// fails on every node alike.
+var errImagePull = errors.New("failed to pull the inspector image")
+
+var imagePullReasons = []string{"ErrImagePull", "ImagePullBackOff", "InvalidImageName", "ErrImageNeverPull"}
+
+// imagePullError returns an error wrapping errImagePull if the named
+// container waits for an image that cannot be pulled.
+func imagePullError(statuses []corev1.ContainerStatus, name string) error {
+	for _, status := range statuses {
+		if status.Name != name || status.State.Waiting == nil {
+			continue
+		}
+		if waiting := status.State.Waiting; slices.Contains(imagePullReasons, waiting.Reason) {
+			return fmt.Errorf("%w %s: %s: %s", errImagePull, status.Image, waiting.Reason, waiting.Message)
+		}
+	}
+	return nil
+}
+
+// checkInspectorImage starts the inspector of the first node before the
+// others are fanned out to, so that an image that cannot be pulled, e.g. from
+// an air-gapped cluster, fails the scan once instead of on every node.
+func (s *Scanner) checkInspectorImage(ctx context.Context, nodes []corev1.Node) error {
+	if len(nodes) < 2 || s.method != MethodInspectorPod && s.method != MethodEphemeralContainer {
+		return nil
+	}
+	_, _, err := s.ensureTarget(ctx, nodes[0].Name, true)
+	if errors.Is(err, errImagePull) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package pressure
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Method selects where the commands inspecting the maps of a node run.
+type Method string
+
+const (
+	// MethodAuto runs the commands in the cilium-agent containers, with
+	// cilium-dbg when their image has no bpftool. It only creates inspector
+	// pods when bpftool is required, e.g. by SourceBpftool.
+	MethodAuto Method = "auto"
+	// MethodAgentExec runs the commands in the cilium-agent containers, so
+	// no workloads are created.
+	MethodAgentExec Method = "agent-exec"
+	// MethodInspectorPod creates a privileged inspector pod on every node.
+	MethodInspectorPod Method = "inspector-pod"
+	// MethodEphemeralContainer adds an ephemeral container with bpftool to
+	// the cilium-agent pod of every node.
+	MethodEphemeralContainer Method = "ephemeral-container"
+)
+
+// Methods lists the supported methods.
+var Methods = []Method{MethodAuto, MethodAgentExec, MethodInspectorPod, MethodEphemeralContainer}
+
+func ParseMethod(s string) (Method, error) {
+	if s == "" {
+		return MethodAuto, nil
+	}
+	m := Method(s)
+	if !slices.Contains(Methods, m) {
+		return "", fmt.Errorf("unknown method %q, must be one of %s", s, joinNames(Methods))
+	}
+	return m, nil
+}
+
+// Source selects how the maps are inspected.
+type Source string
+
+const (
+	// SourceAuto uses SourceBpftool, unless the method is auto or agent-exec
+	// and the agent image has no bpftool.
+	SourceAuto Source = "auto"
+	// SourceBpftool reads the maps with bpftool.
+	SourceBpftool Source = "bpftool"
+	// SourceCiliumDbg reads the map sizes and pressure cilium-agent reports
+	// through cilium-dbg. It requires agent-exec.
+	SourceCiliumDbg Source = "cilium-dbg"
+	// SourceMetrics reads the pressure of the maps from the bpf_map_pressure
+	// metric of cilium-agent, and the maps it does not cover with bpftool.
+	SourceMetrics Source = "metrics"
+)
+
+// Sources lists the supported sources.
+var Sources = []Source{SourceAuto, SourceBpftool, SourceCiliumDbg, SourceMetrics}
+
+func ParseSource(s string) (Source, error) {
+	if s == "" {
+		return SourceAuto, nil
+	}
+	source := Source(s)
+	if !slices.Contains(Sources, source) {
+		return "", fmt.Errorf("unknown source %q, must be one of %s", s, joinNames(Sources))
+	}
+	return source, nil
+}
+
+func joinNames[T ~string](values []T) string {
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		names = append(names, string(v))
+	}
+	return strings.Join(names, ", ")
+}
+
+// lookupBpftoolCmd exits with a non-zero code if bpftool is not installed.
+var lookupBpftoolCmd = []string{"sh", "-c", "command -v bpftool"}
+
+// target is the container the commands of a node run in.
+type target struct {
+	pod       *corev1.Pod
+	container string
+}
+
+func (t *target) podName() string {
+	if t == nil {
+		return ""
+	}
+	return t.pod.Name
+}
+
+// prepareMethod resolves the method and source of a scan of the nodes and
+// creates the inspector namespace if it is needed.
+func (s *Scanner) prepareMethod(ctx context.Context, nodes []corev1.Node) error {
+	s.method, s.source = s.opts.Method, s.opts.Source
+	if s.source == SourceCiliumDbg {
+		s.method = MethodAgentExec
+	}
+	// The metrics are scraped from the agent pods whatever the method is.
+	var err error
+	if s.method != MethodInspectorPod || s.source == SourceMetrics {
+		err = s.loadAgentPods(ctx, nodes)
+	}
+	switch {
+	case err == nil:
+	case s.method == MethodAuto:
+		fmt.Fprintf(s.progress, "Using inspector pods: %v\n", err)
+		s.method = MethodInspectorPod
+	case s.method == MethodInspectorPod:
+		fmt.Fprintf(s.progress, "Reading all maps with bpftool: %v\n", err)
+	default:
+		return err
+	}
+	if s.method == MethodAuto || s.method == MethodAgentExec && s.source == SourceAuto {
+		s.resolveAuto(ctx)
+	}
+	if s.source == SourceAuto {
+		s.source = SourceBpftool
+	}
+
+	if s.method != MethodInspectorPod {
+		return nil
+	}
+	err = s.ensureInspectNS()
+	if err != nil {
+		fmt.Fprintf(s.progress, "Failed to create namespace %s: %v\n", inspectNS, err)
+		return err
+	}
+	return s.copyPullSecrets(ctx)
+}
+
+// loadAgentPods finds the running cilium-agent pod of every node.
+func (s *Scanner) loadAgentPods(ctx context.Context, nodes []corev1.Node) error {
+	ctx, cancel := context.WithTimeout(ctx, k8sTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	pods, err := check.NodeFilter{Names: names}.AgentPods(ctx, s.env.Client)
+	if err != nil {
+		return err
+	}
+
+	s.agentPods = make(map[string]*corev1.Pod)
+	for i := range pods {
+		pod := &pods[i]
+		if pod.Status.Phase == corev1.PodRunning {
+			s.agentPods[pod.Spec.NodeName] = pod
+		}
+	}
+	if len(s.agentPods) == 0 {
+		return fmt.Errorf("no running cilium-agent pods found on the selected nodes")
+	}
+	return nil
+}
+
+// resolveAuto checks one cilium-agent container for bpftool, as all agents
+// of a cluster run the same image. Without bpftool, the maps are read through
+// cilium-dbg in the agents, unless bpftool or the metrics were asked for, in
+// which case the auto method falls back to inspector pods.
+func (s *Scanner) resolveAuto(ctx context.Context) {
+	nodeNames := make([]string, 0, len(s.agentPods))
+	for nodeName := range s.agentPods {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	slices.Sort(nodeNames)
+
+	agent := &target{pod: s.agentPods[nodeNames[0]], container: check.AgentContainer}
+	_, err := s.execCmd(ctx, agent, lookupBpftoolCmd)
+	switch {
+	case err == nil:
+		fmt.Fprintln(s.progress, "Running bpftool in the cilium-agent containers")
+		s.method = MethodAgentExec
+	case s.source == SourceAuto:
+		fmt.Fprintf(s.progress, "Reading the map pressure from cilium-dbg, bpftool is not available in the cilium-agent container of pod %s: %v\n", agent.pod.Name, err)
+		s.method, s.source = MethodAgentExec, SourceCiliumDbg
+	default:
+		fmt.Fprintf(s.progress, "Using inspector pods, bpftool is not available in the cilium-agent container of pod %s: %v\n", agent.pod.Name, err)
+		s.method = MethodInspectorPod
+	}
+}
+
+// ensureTarget prepares the container the commands of a node run in.
+// release, if not nil, removes what was created for the node once it is
+// inspected.
+func (s *Scanner) ensureTarget(ctx context.Context, nodeName string, keepPod bool) (t *target, release func(), err error) {
+	if s.method == MethodInspectorPod {
+		inspectorPod, err := s.ensureInspectorPod(ctx, nodeName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to ensure inspector pod: %w", err)
+		}
+		t = &target{pod: inspectorPod, container: containerName}
+		if keepPod {
+			return t, nil, nil
+		}
+		return t, func() { s.deletePod(inspectorPod.Name) }, nil
+	}
+
+	agentPod, ok := s.agentPods[nodeName]
+	if !ok {
+		return nil, nil, fmt.Errorf("no running cilium-agent pod on node %s", nodeName)
+	}
+	if s.method == MethodEphemeralContainer {
+		t, err = s.ensureEphemeralContainer(ctx, agentPod)
+		return t, nil, err
+	}
+	return &target{pod: agentPod, container: check.AgentContainer}, nil, nil
+}
@@ -0,0 +1,79 @@
+package pressure
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/agentmetrics"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+)
+
+// metricsMethod is the count method of the maps read from the metrics of the
+// agent. Their entries and size are not known, only their usage.
+const metricsMethod = "metrics"
+
+// scrapePressure reads the pressure of the selected maps from the metrics of
+// the cilium-agent pod of the node and returns the names of the maps it
+// covers. The remaining maps are inspected with bpftool.
+func (s *Scanner) scrapePressure(ctx context.Context, n *node) []string {
+	agentPod, ok := s.agentPods[n.name]
+	if !ok {
+		fmt.Fprintf(s.progress, "Reading all maps of node %s with bpftool: no running cilium-agent pod\n", n.name)
+		return nil
+	}
+
+	port := agentmetrics.DefaultPort
+	if s.ciliumConfig != nil {
+		var enabled bool
+		port, enabled = s.ciliumConfig.MetricsPort()
+		if !enabled {
+			fmt.Fprintf(s.progress, "Reading all maps of node %s with bpftool: cilium-agent metrics are disabled\n", n.name)
+			return nil
+		}
+	}
+
+	scrapeCtx, cancel := context.WithTimeout(ctx, k8sTimeout)
+	defer cancel()
+	metrics, err := agentmetrics.Scrape(scrapeCtx, s.env.Client, agentPod, port)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Reading all maps of node %s with bpftool: %v\n", n.name, err)
+		return nil
+	}
+	pressure, err := agentmetrics.ParsePressure(metrics)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Reading all maps of node %s with bpftool: %v\n", n.name, err)
+		return nil
+	}
+
+	var covered []string
+	for mapName, ratio := range pressure {
+		if !s.selectMap(mapName) {
+			continue
+		}
+		fmt.Fprintf(s.progress, "Read BPF map pressure... %s in node: %s (%.2f%% via %s)\n", mapName, n.name, ratio*100, metricsMethod)
+		n.bpfMaps[mapName] = &bpfMap{
+			name:        mapName,
+			usage:       ratio * 100,
+			status:      check.StatusOf(s.opts.Thresholds.ClassifyRatio(mapName, ratio)),
+			countMethod: metricsMethod,
+		}
+		covered = append(covered, mapName)
+	}
+	slices.Sort(covered)
+	return covered
+}
+
+// coversSelection reports whether the metrics covered every map the scan
+// selects, so that bpftool does not need to run on the node.
+func (s *Scanner) coversSelection(n *node, covered []string) bool {
+	if s.opts.AllMaps || len(s.opts.MapPatterns) > 0 || s.opts.PolicyMaps {
+		return false
+	}
+	for mapName := range n.bpfMaps {
+		if !slices.Contains(covered, mapName) {
+			return false
+		}
+	}
+	return true
+}
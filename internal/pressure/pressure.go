@@ -1,56 +1,49 @@
 package pressure
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
-	"strconv"
-	"strings"
+	"path"
+	"slices"
 	"sync"
-	"syscall"
 	"text/tabwriter"
 	"time"
 
-	"github.com/alitto/pond/v2"
+	"github.com/gyutaeb/kubectl-cilium/internal/batch"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumdbg"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumendpoint"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"golang.org/x/term"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/remotecommand"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
-	cmdTimeout   = 1800 * time.Second
-	k8sTimeout   = 60 * time.Second
-	warningRatio = 0.8
+	cmdTimeout = 1800 * time.Second
+	k8sTimeout = 60 * time.Second
 
 	globalsDir    = "/sys/fs/bpf/tc/globals"
 	podNamePrefix = "bpf-inspector"
 	containerName = podNamePrefix
 	inspectNS     = "bpf-inspect"
-)
 
-var (
-	bpfMapNames = []string{"cilium_ct4_global", "cilium_ct6_global", "cilium_ct_any4_global", "cilium_ct_any6_global",
-		"cilium_nodeport_neigh4", "cilium_nodeport_neigh6", "cilium_snat_v4_external", "cilium_snat_v6_external",
-	}
-	shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	bpffsMountPath = "/sys/fs/bpf"
 )
 
-type bpfMapStatus string
+var (
+	bpfMapNames = bpfmaps.Names()
 
-const (
-	Unknown bpfMapStatus = "[Unknown]"
-	OK      bpfMapStatus = "[O.K.]"
-	Warning bpfMapStatus = "[Warning]"
+	inspectorCapabilities = []corev1.Capability{"SYS_ADMIN", "SYS_RESOURCE", "NET_ADMIN", "NET_RAW"}
 )
 
 type bpfMap struct {
@@ -58,120 +51,276 @@ type bpfMap struct {
 	maxEntries     int
 	currentEntries int
 	usage          float64
-	status         bpfMapStatus
+	status         check.Status
 	errMsg         string
+	info           bpftool.MapInfo
+	countMethod    string
+	countDuration  time.Duration
 }
 
 type node struct {
-	name    string
-	bpfMaps map[string]*bpfMap
+	name      string
+	target    *target
+	memory    int64
+	addresses []string
+	bpfMaps   map[string]*bpfMap
 }
 
-type Scanner struct {
-	kc      *kubernetes.Clientset
-	restCfg *rest.Config
+type Options struct {
+	check.Options
+	// PolicyMaps also inspects the per-endpoint policy maps of every node and
+	// resolves their endpoints to pods.
+	PolicyMaps bool
+	// MapPatterns selects the pinned maps to inspect by shell pattern instead
+	// of the maps of the catalog.
+	MapPatterns []string
+	// AllMaps inspects every pinned map.
+	AllMaps bool
+	// Method selects where the commands inspecting the maps run.
+	// MethodAuto is used when it is empty.
+	Method Method
+	// Source selects how the maps are inspected. SourceAuto is used when it
+	// is empty.
+	Source Source
+	// Inspector configures the inspector pods and ephemeral containers.
+	// The defaults are used for an empty image or empty resources.
+	Inspector Inspector
+}
 
-	mu    sync.RWMutex
-	nodes map[string]*node
+type Scanner struct {
+	// env.Dynamic reads the CiliumEndpoint objects. Policy maps are not
+	// resolved to pods when it is nil.
+	env  *check.Env
+	opts Options
+	out  io.Writer
+	// progress receives the progress and cleanup messages of the scans.
+	progress *progressWriter
+
+	ciliumConfig *ciliumconfig.Config
+	endpoints    ciliumendpoint.Index
+
+	// method and source are resolved for the current scan, never auto.
+	method    Method
+	source    Source
+	agentPods map[string]*corev1.Pod
+	// helperOnce looks up the bpf-map-count helper before the first dump.
+	helperOnce sync.Once
+
+	mu        sync.RWMutex
+	nodes     map[string]*node
+	ephemeral map[string]*target
 }
 
-func NewScanner(kc *kubernetes.Clientset, restCfg *rest.Config, kubeconfig string) (*Scanner, error) {
-	if kc == nil || restCfg == nil {
-		if kubeconfig == "" {
-			kubeconfig = os.ExpandEnv("$HOME/.kube/config")
-		}
-		if kubeconfig == "" {
-			kubeconfig = os.Getenv("KUBECONFIG")
-		}
-		var err error
-		kc, restCfg, err = kubernetesClient(kubeconfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-		}
+var (
+	_ check.Check   = (*Scanner)(nil)
+	_ check.Watcher = (*Scanner)(nil)
+)
+
+func NewScanner(env *check.Env, opts Options) (*Scanner, error) {
+	opts.Options = opts.Options.WithDefaults()
+	if opts.Method == "" {
+		opts.Method = MethodAuto
+	}
+	if opts.Source == "" {
+		opts.Source = SourceAuto
+	}
+	if opts.Inspector.Image == "" {
+		opts.Inspector.Image = defaultInspectorImage
+	}
+	if opts.Inspector.Resources.Requests == nil && opts.Inspector.Resources.Limits == nil {
+		opts.Inspector.Resources = DefaultInspector().Resources
 	}
 
 	return &Scanner{
-		kc:      kc,
-		restCfg: restCfg,
-		nodes:   make(map[string]*node),
+		env:       env,
+		opts:      opts,
+		out:       os.Stdout,
+		progress:  &progressWriter{w: os.Stderr},
+		nodes:     make(map[string]*node),
+		ephemeral: make(map[string]*target),
 	}, nil
 }
 
 func (s *Scanner) Validate() (err error) {
-	return nil
+	if s.opts.Source == SourceCiliumDbg && s.opts.Method != MethodAuto && s.opts.Method != MethodAgentExec {
+		return fmt.Errorf("source %s requires method %s", SourceCiliumDbg, MethodAgentExec)
+	}
+	for _, pattern := range s.opts.MapPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid map pattern %q: %w", pattern, err)
+		}
+	}
+	return s.opts.Inspector.Validate()
+}
+
+func (s *Scanner) Run(nodes check.NodeFilter) error {
+	return s.scan(context.Background(), nodes, s.printResult)
+}
+
+// Collect scans the nodes like Run without printing anything.
+// The outcome is available from Result.
+func (s *Scanner) Collect(ctx context.Context, nodes check.NodeFilter) error {
+	return s.scan(ctx, nodes, nil)
 }
 
-func (s *Scanner) Run(targetNodeName string) error {
-	const poolSize = 10
+func (s *Scanner) Evaluate() check.Report {
+	return s.Result()
+}
 
-	nodes, err := s.listNodes(targetNodeName)
+// scan inspects the nodes and calls report, if any, before the inspector pods
+// are cleaned up. The cleanup also runs once parentCtx is cancelled, e.g. by a
+// signal.
+func (s *Scanner) scan(parentCtx context.Context, nodeFilter check.NodeFilter, report func() error) error {
+	nodes, err := s.listNodes(nodeFilter)
 	if err != nil {
 		return fmt.Errorf("failed to get nodes: %w", err)
 	}
 
-	err = s.ensureInspectNS()
+	s.loadCiliumConfig()
+	s.loadEndpoints()
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	err = s.prepareMethod(ctx, nodes)
 	if err != nil {
-		fmt.Printf("Failed to create namespace %s: %v\n", inspectNS, err)
+		cancel()
 		return err
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), shutdownSignals...)
 	shutdownWG := &sync.WaitGroup{}
 	shutdownWG.Add(1)
 	go s.startShutdownHandler(ctx, shutdownWG, nodes)
 
-	pool := pond.NewPool(poolSize, pond.WithContext(ctx))
-	for _, node := range nodes {
-		pool.Submit(func() {
-			s.inspectNode(ctx, node)
-		})
+	err = s.checkInspectorImage(ctx, nodes)
+	if err != nil {
+		cancel()
+		shutdownWG.Wait()
+		return err
 	}
-	pool.StopAndWait()
 
-	err = s.printResult()
-	if err != nil {
-		return fmt.Errorf("failed to print results: %w", err)
+	s.inspectNodes(ctx, nodes, false)
+
+	if report != nil {
+		err = report()
 	}
 
 	/* Trigger shutdown handler */
 	cancel()
 	shutdownWG.Wait()
 
+	if err != nil {
+		return fmt.Errorf("failed to print results: %w", err)
+	}
 	return nil
 }
 
-func (s *Scanner) listNodes(targetNodeName string) ([]corev1.Node, error) {
+// Watch scans the nodes every interval and redraws the result with the change
+// since the previous scan until ctx is cancelled. The inspector pods are kept
+// between scans and only cleaned up on exit. The progress of the re-scans is
+// muted, it would be drawn over the result, but the cleanup is shown.
+func (s *Scanner) Watch(ctx context.Context, nodes check.NodeFilter, interval time.Duration) error {
+	session, err := s.Open(ctx, nodes)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var previous *Result
+	for session.ctx.Err() == nil {
+		current := session.Scan()
+		if session.ctx.Err() != nil {
+			break
+		}
+
+		err = s.printWatch(previous, current, interval)
+		if err != nil {
+			break
+		}
+		previous = current
+		s.progress.mute(true)
+
+		select {
+		case <-session.Done():
+		case <-ticker.C:
+		}
+	}
+
+	s.progress.mute(false)
+	session.Close()
+
+	if err != nil {
+		return fmt.Errorf("failed to print results: %w", err)
+	}
+	return nil
+}
+
+// inspectNodes inspects the nodes in parallel. The inspector pods are deleted
+// once a node is inspected unless keepPods is set.
+func (s *Scanner) inspectNodes(ctx context.Context, nodes []corev1.Node, keepPods bool) {
+	check.ForEach(ctx, s.opts.Concurrency, nodes, func(node corev1.Node) {
+		s.inspectNode(ctx, node, keepPods)
+	})
+}
+
+func (s *Scanner) listNodes(nodeFilter check.NodeFilter) ([]corev1.Node, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
 	defer cancel()
 
-	nodes, err := s.kc.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	nodes, err := nodeFilter.Nodes(ctx, s.env.Client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no nodes found")
 	}
+	return nodes, nil
+}
 
-	if targetNodeName != "" {
-		var filteredNodes []corev1.Node
-		for _, node := range nodes.Items {
-			if node.Name == targetNodeName {
-				filteredNodes = append(filteredNodes, node)
-			}
-		}
-		nodes.Items = filteredNodes
+func (s *Scanner) loadCiliumConfig() {
+	ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+	defer cancel()
+
+	cfg, err := ciliumconfig.Load(ctx, s.env.Client)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Failed to read Cilium configuration, map sizing will not be explained: %v\n", err)
+		return
 	}
+	s.ciliumConfig = cfg
+}
 
-	if len(nodes.Items) == 0 {
-		return nil, fmt.Errorf("no nodes found")
+// loadEndpoints reads the CiliumEndpoint objects to resolve policy maps to pods.
+func (s *Scanner) loadEndpoints() {
+	if !s.opts.PolicyMaps || s.env.Dynamic == nil {
+		return
 	}
 
-	return nodes.Items, nil
+	ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
+	defer cancel()
+
+	endpoints, err := ciliumendpoint.List(ctx, s.env.Dynamic)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Failed to read Cilium endpoints, policy maps will not be resolved to pods: %v\n", err)
+		return
+	}
+	s.endpoints = endpoints
 }
 
-func (s *Scanner) startShutdownHandler(sigCtx context.Context, wg *sync.WaitGroup, nodes []corev1.Node) {
-	<-sigCtx.Done()
-	signal.Ignore(shutdownSignals...)
+func (s *Scanner) startShutdownHandler(ctx context.Context, wg *sync.WaitGroup, nodes []corev1.Node) {
+	<-ctx.Done()
 	defer wg.Done()
+	s.progress.mute(false)
+
+	switch s.method {
+	case MethodInspectorPod:
+		s.deleteInspectorPods(nodes)
+	case MethodEphemeralContainer:
+		s.stopEphemeralContainers()
+	}
+}
 
-	fmt.Println("\033[33mPlease wait for cleanup to complete...\033[0m")
+func (s *Scanner) deleteInspectorPods(nodes []corev1.Node) {
+	fmt.Fprintln(s.progress, "\033[33mPlease wait for cleanup to complete...\033[0m")
 
 	for _, node := range nodes {
 		inspectorPodName := fmt.Sprintf("%s-%s", podNamePrefix, node.Name)
@@ -182,55 +331,91 @@ func (s *Scanner) startShutdownHandler(sigCtx context.Context, wg *sync.WaitGrou
 	defer cancel()
 
 	err := wait.PollUntilContextTimeout(ctx, 5*time.Second, k8sTimeout, true, func(ctx context.Context) (bool, error) {
-		pods, err := s.kc.CoreV1().Pods(inspectNS).List(ctx, metav1.ListOptions{})
+		pods, err := s.env.Client.CoreV1().Pods(inspectNS).List(ctx, metav1.ListOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to list pods: %w", err)
 		}
 		if len(pods.Items) == 0 {
 			return true, nil
 		}
-		fmt.Printf("\033[33mWaiting for inspector pods to be deleted... Remaining pods: %d\033[0m\n", len(pods.Items))
+		fmt.Fprintf(s.progress, "\033[33mWaiting for inspector pods to be deleted... Remaining pods: %d\033[0m\n", len(pods.Items))
 		return false, nil
 	})
 	if err != nil {
-		fmt.Printf("Error waiting for pods to be deleted: %v\n", err)
+		fmt.Fprintf(s.progress, "Error waiting for pods to be deleted: %v\n", err)
 		return
 	}
 
 	err = s.deleteInspectorNamespace()
 	if err != nil {
-		fmt.Printf("Error deleting namespace %s: %v\n", inspectNS, err)
+		fmt.Fprintf(s.progress, "Error deleting namespace %s: %v\n", inspectNS, err)
 		return
 	}
 
-	fmt.Println("\033[33mAll inspector pods deleted successfully.\033[0m")
+	fmt.Fprintln(s.progress, "\033[33mAll inspector pods deleted successfully.\033[0m")
 }
 
-func (s *Scanner) inspectNode(ctx context.Context, node corev1.Node) {
-	fmt.Printf("Inspecting node... %s\n", node.Name)
+func (s *Scanner) inspectNode(ctx context.Context, node corev1.Node, keepPod bool) {
+	fmt.Fprintf(s.progress, "Inspecting node... %s\n", node.Name)
+
+	n := s.newNode(node.Name)
+	n.memory = node.Status.Capacity.Memory().Value()
+	for _, addr := range node.Status.Addresses {
+		n.addresses = append(n.addresses, addr.Address)
+	}
+	defer func() {
+		s.shareMaps(n)
+		s.mu.Lock()
+		s.nodes[node.Name] = n
+		s.mu.Unlock()
+	}()
+
+	var covered []string
+	if s.source == SourceMetrics {
+		covered = s.scrapePressure(ctx, n)
+		if s.coversSelection(n, covered) {
+			n.target = &target{pod: s.agentPods[node.Name], container: check.AgentContainer}
+			return
+		}
+	}
 
-	inspectorPod, err := s.ensureInspectorPod(ctx, node.Name)
+	t, release, err := s.ensureTarget(ctx, node.Name, keepPod)
 	if err != nil {
-		fmt.Printf("Failed to ensure inspector pod on node %s: %v\n", node.Name, err)
+		fmt.Fprintf(s.progress, "Failed to prepare node %s: %v\n", node.Name, err)
+		setErr(n, covered, err)
+		return
+	}
+	if release != nil {
+		defer release()
 	}
-	defer s.deletePod(inspectorPod.Name)
 
-	n := newNode(node.Name)
-	s.filterExistingBpfMaps(ctx, n, inspectorPod)
+	n.target = t
+	err = s.inspectBpfMaps(ctx, n, t, covered)
+	if err != nil {
+		fmt.Fprintf(s.progress, "Failed to inspect BPF maps in node %s: %v\n", node.Name, err)
+		setErr(n, covered, err)
+	}
+}
 
+// shareMaps stores the maps of the node that were counted in the map cache of
+// the environment, for the checks that run after the scan.
+func (s *Scanner) shareMaps(n *node) {
 	for mapName, bpfMap := range n.bpfMaps {
-		fmt.Printf("Inspecting BPF map... %s in node: %s\n", mapName, node.Name)
-		bpfMapStats, err := s.getBpfMapStats(ctx, inspectorPod, mapName)
-		if err != nil {
-			bpfMap.errMsg = err.Error()
+		if bpfMap.errMsg != "" || bpfMap.maxEntries == 0 {
 			continue
 		}
-		n.bpfMaps[mapName] = bpfMapStats
+		s.env.Maps.Store(n.name, mapName, check.MapStats{Info: bpfMap.info, CurrentEntries: bpfMap.currentEntries})
 	}
+}
 
-	s.mu.Lock()
-	s.nodes[node.Name] = n
-	s.mu.Unlock()
+// setErr reports err on the maps of the node that were not covered by the
+// metrics of the agent.
+func setErr(n *node, covered []string, err error) {
+	for mapName, bpfMap := range n.bpfMaps {
+		if !slices.Contains(covered, mapName) {
+			bpfMap.errMsg = err.Error()
+		}
+	}
 }
 
 func (s *Scanner) ensureInspectNS() error {
@@ -243,7 +428,7 @@ func (s *Scanner) ensureInspectNS() error {
 		},
 	}
 
-	_, err := s.kc.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	_, err := s.env.Client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
 	if err != nil && !errors.IsAlreadyExists(err) {
 		return fmt.Errorf("failed to create namespace %s: %w", namespace.Name, err)
 	}
@@ -255,7 +440,7 @@ func (s *Scanner) deleteInspectorNamespace() error {
 	ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
 	defer cancel()
 
-	err := s.kc.CoreV1().Namespaces().Delete(ctx, inspectNS, metav1.DeleteOptions{})
+	err := s.env.Client.CoreV1().Namespaces().Delete(ctx, inspectNS, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		return fmt.Errorf("failed to delete namespace %s: %w", inspectNS, err)
 	}
@@ -267,135 +452,249 @@ func (s *Scanner) deletePod(podName string) {
 	ctx, cancel := context.WithTimeout(context.Background(), k8sTimeout)
 	defer cancel()
 
-	err := s.kc.CoreV1().Pods(inspectNS).Delete(ctx, podName, metav1.DeleteOptions{})
+	err := s.env.Client.CoreV1().Pods(inspectNS).Delete(ctx, podName, metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		fmt.Printf("failed to delete pod %s: %v\n", podName, err)
+		fmt.Fprintf(s.progress, "failed to delete pod %s: %v\n", podName, err)
 	}
 }
 
-func (s *Scanner) getBpfMapStats(ctx context.Context, pod *corev1.Pod, mapName string) (*bpfMap, error) {
-	cmd := []string{"sh", "-c",
-		fmt.Sprintf("bpftool map show pinned %s/%s | grep -o 'max_entries [0-9]\\+' | awk '{print $2}'", globalsDir, mapName),
+// inspectBpfMaps inspects all selected maps of the node with a single exec
+// into its target, except for the maps covered by the metrics of the agent.
+// Maps missing on the node are dropped, and so are preallocated maps such as
+// arrays, which are always full. The maps of the enabled IP families that
+// cilium-dbg does not report are kept as Unknown.
+func (s *Scanner) inspectBpfMaps(ctx context.Context, n *node, t *target, covered []string) error {
+	var mapStats []batch.Stats
+	if s.source == SourceCiliumDbg {
+		result, err := s.execCmd(ctx, t, ciliumdbg.Cmd)
+		if err != nil {
+			return err
+		}
+		mapStats, err = ciliumdbg.Parse(result)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.helperOnce.Do(func() { s.checkCountHelper(ctx, t) })
+		result, err := s.execCmd(ctx, t, batch.Cmd(globalsDir, s.batchPatterns(), covered...))
+		if err != nil {
+			return err
+		}
+		mapStats = batch.Parse(result)
 	}
-	result, err := s.execCmd(ctx, pod, cmd)
-	if err != nil {
-		return nil, err
+
+	pinned := map[string]bool{}
+	for _, mapName := range covered {
+		pinned[mapName] = true
 	}
-	maxEntries, err := strconv.Atoi(result)
-	if err != nil {
-		return nil, err
+	for _, stats := range mapStats {
+		if stats.Map == "" {
+			fmt.Fprintf(s.progress, "Skipping BPF map output in node %s: %v\n", n.name, stats.Err)
+			continue
+		}
+		if !s.selectMap(stats.Map) {
+			continue
+		}
+		if stats.Info != nil && !stats.Info.HasUsage() {
+			fmt.Fprintf(s.progress, "Skipping BPF map %s in node %s: %s maps are preallocated, their usage is always 100%%\n", stats.Map, n.name, stats.Info.Type)
+			continue
+		}
+		pinned[stats.Map] = true
+		n.bpfMaps[stats.Map] = s.newBpfMap(n, stats)
 	}
 
-	cmd = []string{"sh", "-c",
-		fmt.Sprintf("bpftool map dump pinned %s/%s | grep element | awk '{print $2}'", globalsDir, mapName),
+	for mapName, bpfMap := range n.bpfMaps {
+		if pinned[mapName] {
+			continue
+		}
+		m, _ := bpfmaps.Lookup(mapName)
+		if s.source == SourceCiliumDbg && s.ciliumConfig.FamilyEnabled(m.Family) {
+			/* cilium-dbg does not tell whether a map without pressure metric exists */
+			bpfMap.errMsg = "not reported by cilium-dbg"
+			continue
+		}
+		/* If the map does not exist, skip it. e.g.) ipv6 */
+		delete(n.bpfMaps, mapName)
 	}
-	result, err = s.execCmd(ctx, pod, cmd)
-	if err != nil {
-		return nil, err
+	return nil
+}
+
+// checkCountHelper warns when the bpf-map-count helper is not installed in
+// the target, as the maps are then counted with full dumps. The targets of a
+// scan all run the same image, so only the first one is checked, and the
+// other nodes wait for the warning before they dump their maps.
+func (s *Scanner) checkCountHelper(ctx context.Context, t *target) {
+	_, err := s.execCmd(ctx, t, bpfcount.LookupCmd)
+	if err == nil || ctx.Err() != nil {
+		return
 	}
-	currentEntries, err := strconv.Atoi(result)
-	if err != nil {
-		return nil, err
+	advice := "Pass an --inspector-image that has it, see tools/bpf-map-count."
+	where := "the inspector image " + s.opts.Inspector.Image
+	if s.method == MethodAgentExec {
+		advice = "Use --method=ephemeral-container or inspector-pod with an --inspector-image that has it, see tools/bpf-map-count."
+		where = "the cilium-agent containers"
 	}
+	fmt.Fprintf(s.progress, "\033[33mWarning: %s is not installed in %s, so the maps are counted with full bpftool map dumps, which are slow and memory-hungry on large CT and NAT maps. %s\033[0m\n", bpfcount.HelperName, where, advice)
+}
 
-	usage := float64(currentEntries) / float64(maxEntries) * 100
-	var status bpfMapStatus
+// batchPatterns returns the shell patterns of the maps the inspector pod
+// reports. selectMap still decides which of them are inspected.
+func (s *Scanner) batchPatterns() []string {
+	var patterns []string
+	switch {
+	case s.opts.AllMaps:
+		return []string{"*"}
+	case len(s.opts.MapPatterns) > 0:
+		patterns = append(patterns, s.opts.MapPatterns...)
+	default:
+		patterns = append(patterns, bpfMapNames...)
+	}
+	if s.opts.PolicyMaps {
+		patterns = append(patterns, bpfmaps.PolicyMapPrefix+"*")
+	}
+	return patterns
+}
 
-	if currentEntries >= int(float64(maxEntries)*warningRatio) {
-		status = Warning
-	} else {
-		status = OK
+func (s *Scanner) newBpfMap(n *node, stats batch.Stats) *bpfMap {
+	if stats.Err != nil {
+		return &bpfMap{
+			name:   stats.Map,
+			status: check.Unknown,
+			errMsg: stats.Err.Error(),
+		}
 	}
 
-	bpfMap := &bpfMap{
+	fmt.Fprintf(s.progress, "Counted BPF map... %s in node: %s (%d entries via %s in %s)\n",
+		stats.Map, n.name, stats.Entries, stats.Method, stats.Duration.Round(time.Millisecond))
+
+	maxEntries := stats.Info.MaxEntries
+	usage := float64(stats.Entries) / float64(maxEntries) * 100
+	status := check.StatusOf(s.opts.Thresholds.Classify(stats.Map, stats.Entries, maxEntries))
+
+	return &bpfMap{
+		name:           stats.Map,
 		maxEntries:     maxEntries,
-		currentEntries: currentEntries,
+		currentEntries: stats.Entries,
 		usage:          usage,
 		status:         status,
+		info:           *stats.Info,
+		countMethod:    stats.Method,
+		countDuration:  stats.Duration,
 	}
-
-	return bpfMap, nil
 }
 
-func (s *Scanner) filterExistingBpfMaps(ctx context.Context, n *node, inspectorPod *corev1.Pod) {
-	for _, mapName := range bpfMapNames {
-		exist, err := s.existBpfMap(ctx, inspectorPod, mapName)
-		if err != nil {
-			n.bpfMaps[mapName].errMsg = err.Error()
-			continue
-		} else if !exist {
-			/* If the map does not exist, skip it. e.g.) ipv6 */
-			delete(n.bpfMaps, mapName)
-			continue
-		}
+// selectMap reports whether a pinned map is inspected. Without patterns only
+// the maps of the catalog are.
+func (s *Scanner) selectMap(mapName string) bool {
+	if s.opts.AllMaps {
+		return true
 	}
-}
-
-func (s *Scanner) existBpfMap(ctx context.Context, inspectorPod *corev1.Pod, mapName string) (bool, error) {
-	cmd := []string{"sh", "-c", fmt.Sprintf("[ -f %s/%s ]", globalsDir, mapName)}
-	_, err := s.execCmd(ctx, inspectorPod, cmd)
-	if err != nil {
-		// Error
-		if !strings.Contains(err.Error(), "exit code 1") {
-			return false, err
+	if _, ok := bpfmaps.PolicyEndpointID(mapName); ok && s.opts.PolicyMaps {
+		return true
+	}
+	if len(s.opts.MapPatterns) == 0 {
+		return slices.Contains(bpfMapNames, mapName)
+	}
+	for _, pattern := range s.opts.MapPatterns {
+		if matched, _ := path.Match(pattern, mapName); matched {
+			return true
 		}
-		// Not exist
-		return false, nil
 	}
-	// Exist
-	return true, nil
+	return false
 }
 
 func (s *Scanner) printResult() error {
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-
-	lines := map[bpfMapStatus][]string{
-		Unknown: {},
-		OK:      {},
-		Warning: {},
-	}
-
-	// Organize output by status
-	for nodeName, node := range s.nodes {
-		for mapName, bpfMap := range node.bpfMaps {
-			var line string
-			if bpfMap.status == Unknown {
-				line = fmt.Sprintf("%s\t%s\t%s\tERR:%s\n", Unknown, nodeName, mapName, bpfMap.errMsg)
-			} else {
-				line = fmt.Sprintf("%s\t%s\t%s\t%.2f%%\t%d/%d\n",
-					bpfMap.status, nodeName, mapName, bpfMap.usage, bpfMap.currentEntries, bpfMap.maxEntries)
+	return check.Render(s.out, s.opts.Output, s.Result())
+}
+
+// printWatch redraws the result of a watch scan. Tables show the change of
+// the entries since the previous scan, structured formats are streamed as one
+// document per scan.
+func (s *Scanner) printWatch(previous, current *Result, interval time.Duration) error {
+	switch s.opts.Output {
+	case output.JSON:
+		return output.Encode(s.out, s.opts.Output, current)
+	case output.YAML:
+		fmt.Fprintln(s.out, "---")
+		return output.Encode(s.out, s.opts.Output, current)
+	}
+
+	previousEntries := map[string]int{}
+	if previous != nil {
+		for _, item := range previous.Items {
+			if item.Status != check.Unknown && item.MaxEntries > 0 {
+				previousEntries[item.Node+"/"+item.Map] = item.CurrentEntries
 			}
-			lines[bpfMap.status] = append(lines[bpfMap.status], line)
 		}
 	}
 
-	// Print results
-	fmt.Fprintf(w, "%s", "\nSTATUS\tNODE\tMAP\tUSAGE\tCURRENT/MAX\n")
-	fmt.Fprintf(w, "%s", strings.Join(lines[Warning], ""))
-	fmt.Fprintf(w, "%s", strings.Join(lines[OK], ""))
-	fmt.Fprintf(w, "%s", strings.Join(lines[Unknown], ""))
+	if isTerminal(s.out) {
+		fmt.Fprint(s.out, "\033[H\033[2J")
+	}
+	fmt.Fprintf(s.out, "Every %s: %s\n", interval, time.Now().Format(time.RFC3339))
+
+	w := tabwriter.NewWriter(s.out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "%s", "\nSTATUS\tNODE\tMAP\tUSAGE\tCURRENT/MAX\tDELTA\tTREND\n")
+	for _, item := range current.Items {
+		status := item.Status.Label()
+		if item.Status == check.Unknown {
+			fmt.Fprintf(w, "%s\t%s\t%s\tERR:%s\n", status, item.Node, item.MapLabel(), item.Error)
+			continue
+		}
+		delta, trend := "-", "-"
+		if prev, ok := previousEntries[item.Node+"/"+item.Map]; ok {
+			delta = fmt.Sprintf("%+d", item.CurrentEntries-prev)
+			trend = trendArrow(item.CurrentEntries - prev)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f%%\t%s\t%s\t%s\n",
+			status, item.Node, item.MapLabel(), item.Usage, item.EntriesLabel(), delta, trend)
+	}
 
 	err := w.Flush()
 	if err != nil {
 		return fmt.Errorf("failed to flush tab writer: %w", err)
 	}
+	return nil
+}
 
-	if len(lines[Warning]) > 0 {
-		fmt.Printf("\n\033[38;5;208mIf you see [Warning] status in the output and encounter network issues,\n" +
-			"Please consider increasing --bpf-map-dynamic-size-ratio in cilium-agent configuration.\033[0m\n\n")
+func trendArrow(delta int) string {
+	switch {
+	case delta > 0:
+		return "↑"
+	case delta < 0:
+		return "↓"
+	default:
+		return "→"
 	}
-	return nil
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+func sizingColumn(sizing *ciliumconfig.Sizing) string {
+	if sizing == nil {
+		return "-"
+	}
+	if sizing.Mode == ciliumconfig.Dynamic {
+		return fmt.Sprintf("dynamic(%g)", sizing.DynamicSizeRatio)
+	}
+	return string(sizing.Mode)
+}
+
+func describeSizing(sizing *ciliumconfig.Sizing) string {
+	if sizing.Mode == ciliumconfig.Dynamic {
+		return fmt.Sprintf("dynamic, %g of %s node memory", sizing.DynamicSizeRatio, output.Bytes(sizing.NodeMemory))
+	}
+	if sizing.ConfiguredValue > 0 {
+		return fmt.Sprintf("static, %s=%d", sizing.Option, sizing.ConfiguredValue)
+	}
+	return fmt.Sprintf("static, %s default", sizing.Option)
 }
 
 func (s *Scanner) ensureInspectorPod(parentCtx context.Context, nodeName string) (*corev1.Pod, error) {
-	const (
-		imageName      = "gyutaeb/bpftool:v7.5.0"
-		bpffsMountPath = "/sys/fs/bpf"
-		cpuRequest     = "0"
-		cpuLimit       = "200m"
-	)
 	var (
-		capabilities    = []corev1.Capability{"SYS_ADMIN", "SYS_RESOURCE", "NET_ADMIN", "NET_RAW"}
 		privileged      = true
 		hostToContainer = corev1.MountPropagationHostToContainer
 	)
@@ -410,21 +709,15 @@ func (s *Scanner) ensureInspectorPod(parentCtx context.Context, nodeName string)
 			NodeName: nodeName,
 			Containers: []corev1.Container{
 				{
-					Name:    containerName,
-					Image:   imageName,
-					Command: []string{"sleep", "infinity"},
-					Resources: corev1.ResourceRequirements{
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU: resource.MustParse(cpuRequest),
-						},
-						Limits: corev1.ResourceList{
-							corev1.ResourceCPU: resource.MustParse(cpuLimit),
-						},
-					},
+					Name:            containerName,
+					Image:           s.opts.Inspector.Image,
+					ImagePullPolicy: s.opts.Inspector.ImagePullPolicy,
+					Command:         []string{"sleep", "infinity"},
+					Resources:       s.opts.Inspector.Resources,
 					SecurityContext: &corev1.SecurityContext{
 						Privileged: &privileged,
 						Capabilities: &corev1.Capabilities{
-							Add: capabilities,
+							Add: inspectorCapabilities,
 						},
 					},
 					VolumeMounts: []corev1.VolumeMount{
@@ -447,36 +740,45 @@ func (s *Scanner) ensureInspectorPod(parentCtx context.Context, nodeName string)
 					},
 				},
 			},
-			Tolerations: []corev1.Toleration{
-				{
-					Operator: corev1.TolerationOpExists,
-				},
-			},
+			Tolerations:       s.opts.Inspector.Tolerations,
+			NodeSelector:      s.opts.Inspector.NodeSelector,
+			PriorityClassName: s.opts.Inspector.PriorityClassName,
 		},
 	}
+	if len(inspectorPod.Spec.Tolerations) == 0 {
+		inspectorPod.Spec.Tolerations = []corev1.Toleration{{Operator: corev1.TolerationOpExists}}
+	}
+	for _, secret := range s.opts.Inspector.ImagePullSecrets {
+		_, name := pullSecretRef(secret)
+		inspectorPod.Spec.ImagePullSecrets = append(inspectorPod.Spec.ImagePullSecrets, corev1.LocalObjectReference{Name: name})
+	}
 
 	ctx, cancel := context.WithTimeout(parentCtx, k8sTimeout)
 	defer cancel()
 
-	createdPod, err := s.kc.CoreV1().Pods(inspectNS).Create(ctx, inspectorPod, metav1.CreateOptions{})
+	createdPod, err := s.env.Client.CoreV1().Pods(inspectNS).Create(ctx, inspectorPod, metav1.CreateOptions{})
 	if err != nil {
 		if !errors.IsAlreadyExists(err) {
 			return nil, fmt.Errorf("failed to create inspector pod: %w", err)
 		}
 		createdPod = inspectorPod
+		fmt.Fprintf(s.progress, "Reusing inspector pod: %s\n", createdPod.Name)
+	} else {
+		fmt.Fprintf(s.progress, "Created inspector pod: %s\n", createdPod.Name)
 	}
 
-	fmt.Printf("Created inspector pod: %s\n", createdPod.Name)
-
 	err = wait.PollUntilContextTimeout(ctx, 2*time.Second, k8sTimeout, true, func(ctx context.Context) (bool, error) {
-		pod, err := s.kc.CoreV1().Pods(inspectNS).Get(ctx, createdPod.Name, metav1.GetOptions{})
+		pod, err := s.env.Client.CoreV1().Pods(inspectNS).Get(ctx, createdPod.Name, metav1.GetOptions{})
 		if err != nil {
 			return false, fmt.Errorf("failed to get inspector pod: %w", err)
 		}
-		if pod.Status.Phase == corev1.PodRunning {
+		switch pod.Status.Phase {
+		case corev1.PodRunning:
 			return true, nil
+		case corev1.PodFailed:
+			return false, fmt.Errorf("inspector pod failed: %s: %s", pod.Status.Reason, pod.Status.Message)
 		}
-		return false, nil
+		return false, imagePullError(pod.Status.ContainerStatuses, containerName)
 	})
 
 	if err != nil {
@@ -486,61 +788,27 @@ func (s *Scanner) ensureInspectorPod(parentCtx context.Context, nodeName string)
 	return createdPod, nil
 }
 
-func (s *Scanner) execCmd(parentCtx context.Context, pod *corev1.Pod, cmd []string) (string, error) {
-	req := s.kc.CoreV1().RESTClient().Post().Namespace(inspectNS).Resource("pods").
-		Name(pod.Name).SubResource("exec").VersionedParams(&corev1.PodExecOptions{
-		Container: containerName,
-		Command:   cmd,
-		Stdout:    true,
-		Stderr:    true,
-	}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(s.restCfg, "POST", req.URL())
-	if err != nil {
-		fmt.Printf("[Pre-exec-error] pod:%s, node:%s, err:%v\n", pod.Name, pod.Spec.NodeName, err)
-		return "", err
-	}
-
-	var stdout, stderr bytes.Buffer
-	ctx, cancle := context.WithTimeout(parentCtx, cmdTimeout)
-	defer cancle()
-
-	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-		Stdout: &stdout,
-		Stderr: &stderr,
-	})
-	if err != nil {
-		return "", err
-	}
-
-	return strings.TrimSpace(stdout.String()), nil
+func (s *Scanner) execCmd(ctx context.Context, t *target, cmd []string) (string, error) {
+	return s.env.Exec(ctx, t.pod, t.container, cmd, cmdTimeout)
 }
 
-func newNode(nodeName string) *node {
+// newNode creates a node with the selected maps of the catalog, which are
+// reported as Unknown if the node cannot be inspected.
+func (s *Scanner) newNode(nodeName string) *node {
 	n := &node{
 		name:    nodeName,
 		bpfMaps: make(map[string]*bpfMap),
 	}
 
 	for _, mapName := range bpfMapNames {
+		if !s.selectMap(mapName) {
+			continue
+		}
 		n.bpfMaps[mapName] = &bpfMap{
 			name:   mapName,
-			status: Unknown,
+			status: check.Unknown,
 		}
 	}
 
 	return n
 }
-
-func kubernetesClient(kubeConfig string) (*kubernetes.Clientset, *rest.Config, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	kc, err := kubernetes.NewForConfig(config)
-	if err != nil {
-		return nil, nil, err
-	}
-	return kc, config, nil
-}
@@ -0,0 +1,1127 @@
+package pressure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/batch"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumdbg"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumendpoint"
+	"github.com/gyutaeb/kubectl-cilium/internal/executor/fake"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/threshold"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+type fakeMap struct {
+	maxEntries     int
+	currentEntries int
+	// helper counts the map with the bpf-map-count helper instead of a dump.
+	helper bool
+	// dumpError is printed by bpftool instead of the entries.
+	dumpError string
+	// mapType is the type bpftool shows, lru_hash if it is empty.
+	mapType string
+}
+
+// bpftoolHandler emulates the inspector pod for the given pinned maps.
+// Maps missing from the set do not exist on the node.
+func bpftoolHandler(maps map[string]fakeMap) func(*corev1.Pod, string, []string) (string, error) {
+	return func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if slices.Equal(cmd, bpfcount.LookupCmd) {
+			for _, m := range maps {
+				if m.helper {
+					return "/usr/local/bin/" + bpfcount.HelperName, nil
+				}
+			}
+			return "", fake.ExitError(1)
+		}
+		if args, ok := batchArgs(cmd); ok {
+			return batchOutput(maps, args), nil
+		}
+		return "", fmt.Errorf("unexpected command %q", strings.Join(cmd, " "))
+	}
+}
+
+// batchArgs returns the patterns and exclusions of a batch command.
+func batchArgs(cmd []string) ([]string, bool) {
+	prefix := batch.Cmd(globalsDir, nil)
+	if len(cmd) < len(prefix) || !slices.Equal(cmd[:len(prefix)], prefix) {
+		return nil, false
+	}
+	return cmd[len(prefix):], true
+}
+
+func batchOutput(maps map[string]fakeMap, args []string) string {
+	patterns, excluded := args, []string(nil)
+	if i := slices.Index(args, "--"); i >= 0 {
+		patterns, excluded = args[:i], args[i+1:]
+	}
+
+	var names []string
+	for name := range maps {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		selected := slices.ContainsFunc(patterns, func(pattern string) bool {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		})
+		if !selected || slices.Contains(excluded, name) {
+			continue
+		}
+		m := maps[name]
+		method, count := batch.MethodDump, mapDumpOutput(m.currentEntries)
+		switch {
+		case m.dumpError != "":
+			count = fmt.Sprintf(`{"error":%q}`, m.dumpError)
+		case m.helper:
+			method, count = batch.MethodHelper, fmt.Sprintf(`{"entries":%d,"max_entries":%d}`, m.currentEntries, m.maxEntries)
+		}
+		fmt.Fprintf(&b, `{"map":%q,"method":%q,"show":%s,"count":%s,"nanos":1000000}`+"\n", name, method, mapShowOutput(name, m), count)
+	}
+	return b.String()
+}
+
+func mapShowOutput(name string, m fakeMap) string {
+	mapType := m.mapType
+	if mapType == "" {
+		mapType = "lru_hash"
+	}
+	return fmt.Sprintf(`{"id":7,"type":%q,"name":%q,"flags":0,"bytes_key":14,"bytes_value":56,"max_entries":%d,"bytes_memlock":4096}`,
+		mapType, name[:min(len(name), 15)], m.maxEntries)
+}
+
+func mapDumpOutput(entries int) string {
+	items := make([]string, entries)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"key":["0x%02x"],"value":["0x00"]}`, i%256)
+	}
+	return "[" + strings.Join(items, ",") + "]"
+}
+
+func newTestScanner(t *testing.T, handler func(*corev1.Pod, string, []string) (string, error), nodeNames ...string) (*Scanner, *bytes.Buffer) {
+	t.Helper()
+
+	var objects []runtime.Object
+	for _, name := range nodeNames {
+		objects = append(objects, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	kc := k8sfake.NewClientset(objects...)
+	kc.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		pod := action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		pod.Status.Phase = corev1.PodRunning
+		return false, nil, nil
+	})
+
+	s, err := NewScanner(&check.Env{Client: kc, Executor: &fake.Executor{Handler: handler}}, Options{Options: check.Options{Output: output.JSON}})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	out := &bytes.Buffer{}
+	s.out = out
+	return s, out
+}
+
+func findItem(t *testing.T, result *Result, nodeName, mapName string) MapResult {
+	t.Helper()
+	for _, item := range result.Items {
+		if item.Node == nodeName && item.Map == mapName {
+			return item
+		}
+	}
+	t.Fatalf("no result for map %s on node %s", mapName, nodeName)
+	return MapResult{}
+}
+
+func TestRunParsesMapStats(t *testing.T) {
+	s, out := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global":       {maxEntries: 3562, currentEntries: 2850},
+		"cilium_snat_v4_external": {maxEntries: 3562, currentEntries: 16},
+	}), "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if len(result.Items) != 2 {
+		t.Fatalf("expected 2 maps, got %d: %+v", len(result.Items), result.Items)
+	}
+
+	ct := findItem(t, result, "node-1", "cilium_ct4_global")
+	if ct.MaxEntries != 3562 || ct.CurrentEntries != 2850 {
+		t.Errorf("unexpected ct entries: %+v", ct)
+	}
+	if ct.Type != "lru_hash" || ct.ID != 7 || ct.KeySize != 14 || ct.ValueSize != 56 || ct.Memlock != 4096 {
+		t.Errorf("unexpected map metadata: %+v", ct)
+	}
+	if ct.Status != "Warning" {
+		t.Errorf("expected Warning for ct map, got %s", ct.Status)
+	}
+	if ct.Pod != "bpf-inspector-node-1" {
+		t.Errorf("unexpected pod %q", ct.Pod)
+	}
+
+	snat := findItem(t, result, "node-1", "cilium_snat_v4_external")
+	if snat.Status != "OK" {
+		t.Errorf("expected OK for snat map, got %s", snat.Status)
+	}
+
+	if result.Items[0].Map != "cilium_ct4_global" {
+		t.Errorf("expected warning to be listed first, got %s", result.Items[0].Map)
+	}
+	if !strings.Contains(out.String(), `"apiVersion": "`+ResultAPIVersion+`"`) {
+		t.Errorf("expected JSON output with apiVersion, got %s", out.String())
+	}
+}
+
+func TestRunSharesMaps(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_snat_v4_external": {maxEntries: 3562, currentEntries: 16},
+	}), "node-1")
+	s.env.Maps = check.NewMapCache()
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	stats, ok := s.env.Maps.Load("node-1", "cilium_snat_v4_external")
+	if !ok || stats.CurrentEntries != 16 || stats.Info.MaxEntries != 3562 || stats.Info.Type != "lru_hash" {
+		t.Errorf("expected the snat map to be shared, got %+v", stats)
+	}
+	if _, ok := s.env.Maps.Load("node-1", "cilium_ct4_global"); ok {
+		t.Error("expected the missing ct map not to be shared")
+	}
+}
+
+func TestRunSkipsMissingMaps(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global": {maxEntries: 100, currentEntries: 1},
+	}), "node-1", "node-2")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if len(result.Items) != 2 {
+		t.Fatalf("expected one map per node, got %+v", result.Items)
+	}
+	for _, item := range result.Items {
+		if item.Map != "cilium_ct4_global" {
+			t.Errorf("unexpected map %s", item.Map)
+		}
+	}
+}
+
+func TestRunTargetNode(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global": {maxEntries: 100, currentEntries: 1},
+	}), "node-1", "node-2")
+
+	if err := s.Run(check.NodeFilter{Names: []string{"node-2"}}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if len(result.Items) != 1 || result.Items[0].Node != "node-2" {
+		t.Fatalf("expected only node-2, got %+v", result.Items)
+	}
+
+	if err := s.Run(check.NodeFilter{Names: []string{"node-3"}}); err == nil {
+		t.Errorf("expected an error for an unknown node")
+	}
+}
+
+func TestRunExecFailure(t *testing.T) {
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		return "", errors.New("connection reset")
+	}, "node-1")
+	s.opts.MapPatterns = []string{"cilium_ct4_*"}
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	result := s.Result()
+	if len(result.Items) != 1 || result.Items[0].Status != "Unknown" || !strings.Contains(result.Items[0].Error, "connection reset") {
+		t.Errorf("expected the selected catalog map to be Unknown, got %+v", result.Items)
+	}
+}
+
+func TestRunMapFailure(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global":       {maxEntries: 100, currentEntries: 1},
+		"cilium_snat_v4_external": {maxEntries: 100, dumpError: "can't lock map"},
+	}), "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	snat := findItem(t, result, "node-1", "cilium_snat_v4_external")
+	if snat.Status != "Unknown" || !strings.Contains(snat.Error, "can't lock map") {
+		t.Errorf("expected Unknown with dump error, got %+v", snat)
+	}
+	ct := findItem(t, result, "node-1", "cilium_ct4_global")
+	if ct.Status != "OK" {
+		t.Errorf("expected OK, got %+v", ct)
+	}
+	if result.Items[len(result.Items)-1].Status != "Unknown" {
+		t.Errorf("expected unknown maps to be listed last")
+	}
+}
+
+func TestRunMalformedOutput(t *testing.T) {
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		return "Error: bpf obj get\n" +
+			`{"map":"cilium_ct4_global","method":"dump","show":null,"count":[{"key":` + "\n", nil
+	}, "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if len(result.Items) != 1 {
+		t.Fatalf("expected only the ct map, got %+v", result.Items)
+	}
+	ct := findItem(t, result, "node-1", "cilium_ct4_global")
+	if ct.Status != "Unknown" || ct.Error == "" {
+		t.Errorf("expected Unknown with parse error, got %+v", ct)
+	}
+}
+
+func TestClassification(t *testing.T) {
+	tests := []struct {
+		current int
+		status  check.Status
+	}{
+		{current: 0, status: "OK"},
+		{current: 799, status: "OK"},
+		{current: 800, status: "Warning"},
+		{current: 899, status: "Warning"},
+		{current: 900, status: "Critical"},
+		{current: 1000, status: "Critical"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d", tt.current), func(t *testing.T) {
+			s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+				"cilium_ct4_global": {maxEntries: 1000, currentEntries: tt.current},
+			}), "node-1")
+
+			if err := s.Run(check.NodeFilter{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global")
+			if ct.Status != tt.status {
+				t.Errorf("expected %s, got %s", tt.status, ct.Status)
+			}
+		})
+	}
+}
+
+func TestRunCountHelper(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global":       {maxEntries: 1000, currentEntries: 900, helper: true},
+		"cilium_snat_v4_external": {maxEntries: 1000, currentEntries: 3},
+	}), "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	ct := findItem(t, result, "node-1", "cilium_ct4_global")
+	if ct.CountMethod != "helper" || ct.CurrentEntries != 900 || ct.Status != "Critical" {
+		t.Errorf("expected helper count, got %+v", ct)
+	}
+	snat := findItem(t, result, "node-1", "cilium_snat_v4_external")
+	if snat.CountMethod != "dump" || snat.CurrentEntries != 3 {
+		t.Errorf("expected dump fallback, got %+v", snat)
+	}
+}
+
+func TestRunWarnsWithoutCountHelper(t *testing.T) {
+	tests := []struct {
+		name   string
+		helper bool
+		warned bool
+	}{
+		{name: "helper installed", helper: true},
+		{name: "helper missing", warned: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+				"cilium_ct4_global": {maxEntries: 1000, currentEntries: 10, helper: tt.helper},
+			}), "node-1", "node-2")
+			progress := &bytes.Buffer{}
+			s.progress.set(progress)
+
+			if err := s.Run(check.NodeFilter{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			if got := strings.Count(progress.String(), bpfcount.HelperName+" is not installed"); got != map[bool]int{true: 1}[tt.warned] {
+				t.Errorf("expected warned=%v once for all nodes, got %d warnings in %q", tt.warned, got, progress.String())
+			}
+		})
+	}
+}
+
+func TestRunThresholdOverrides(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global":      {maxEntries: 1000, currentEntries: 750},
+		"cilium_nodeport_neigh4": {maxEntries: 1000, currentEntries: 850},
+	}), "node-1")
+	s.opts.Thresholds = &threshold.Config{
+		Ratios: threshold.Ratios{Warning: 0.8, Critical: 0.9},
+		Maps: map[string]threshold.Ratios{
+			"cilium_ct*":             {Warning: 0.7},
+			"cilium_nodeport_neigh*": {Warning: 0.9, Critical: 0.95},
+		},
+	}
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if ct := findItem(t, result, "node-1", "cilium_ct4_global"); ct.Status != "Warning" {
+		t.Errorf("expected Warning for ct map at 75%%, got %s", ct.Status)
+	}
+	if neigh := findItem(t, result, "node-1", "cilium_nodeport_neigh4"); neigh.Status != "OK" {
+		t.Errorf("expected OK for neigh map at 85%%, got %s", neigh.Status)
+	}
+}
+
+func TestRunExplainsSizing(t *testing.T) {
+	s, out := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global":       {maxEntries: 1000, currentEntries: 850},
+		"cilium_snat_v4_external": {maxEntries: 1000, currentEntries: 10},
+	}), "node-1")
+	s.opts.Output = output.Table
+	err := s.env.Client.(*k8sfake.Clientset).Tracker().Add(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ciliumconfig.ConfigMapName, Namespace: ciliumconfig.Namespace},
+		Data:       map[string]string{ciliumconfig.DynamicSizeRatioKey: "0.0025"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global")
+	if ct.Sizing == nil || ct.Sizing.Mode != ciliumconfig.Dynamic || ct.Sizing.RecommendedRatio != 0.0027 {
+		t.Errorf("unexpected ct sizing %+v", ct.Sizing)
+	}
+	if !strings.Contains(out.String(), "increase bpf-map-dynamic-size-ratio from 0.0025 to at least 0.0027") {
+		t.Errorf("expected a sizing hint, got %s", out.String())
+	}
+}
+
+func TestCollectDoesNotPrint(t *testing.T) {
+	s, out := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global": {maxEntries: 1000, currentEntries: 850},
+	}), "node-1")
+
+	if err := s.Collect(context.Background(), check.NodeFilter{}); err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected no output, got %s", out.String())
+	}
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.CurrentEntries != 850 {
+		t.Errorf("unexpected ct result %+v", ct)
+	}
+}
+
+func TestWatchShowsDeltas(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	samples := []int{100, 150}
+	var scans atomic.Int32
+	s, out := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if slices.Equal(cmd, bpfcount.LookupCmd) {
+			return "", fake.ExitError(1)
+		}
+		n := int(scans.Add(1))
+		if n > len(samples) {
+			cancel()
+			return "", context.Canceled
+		}
+		return bpftoolHandler(map[string]fakeMap{
+			"cilium_ct4_global": {maxEntries: 1000, currentEntries: samples[n-1]},
+		})(pod, container, cmd)
+	}, "node-1")
+	s.opts.Output = output.Table
+	progress := &bytes.Buffer{}
+	s.progress.set(progress)
+
+	if err := s.Watch(ctx, check.NodeFilter{}, time.Millisecond); err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if got := strings.Count(progress.String(), "Inspecting node... node-1"); got != 1 {
+		t.Errorf("expected only the progress of the first scan, got %q", progress.String())
+	}
+	if !strings.Contains(progress.String(), "cleanup") {
+		t.Errorf("expected the progress of the cleanup, got %q", progress.String())
+	}
+
+	if got := strings.Count(out.String(), "STATUS"); got != 2 {
+		t.Fatalf("expected 2 tables, got %d: %s", got, out.String())
+	}
+	if !strings.Contains(out.String(), "+50") || !strings.Contains(out.String(), "↑") {
+		t.Errorf("expected a delta and trend, got %s", out.String())
+	}
+	if pods, _ := s.env.Client.CoreV1().Pods(inspectNS).List(context.Background(), metav1.ListOptions{}); len(pods.Items) != 0 {
+		t.Errorf("expected the inspector pods to be cleaned up, got %d", len(pods.Items))
+	}
+}
+
+func TestSessionSample(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 1000, currentEntries: 3}})
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if slices.Equal(cmd, bpftool.MapSampleCmd(path.Join(globalsDir, "cilium_ct4_global"), sampleBytes)) {
+			return mapDumpOutput(3), nil
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+
+	session, err := s.Open(context.Background(), check.NodeFilter{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer session.Close()
+
+	progress := &bytes.Buffer{}
+	session.SetProgress(progress)
+	if ct := findItem(t, session.Scan(), "node-1", "cilium_ct4_global"); ct.CurrentEntries != 3 {
+		t.Errorf("unexpected ct result %+v", ct)
+	}
+	if !strings.Contains(progress.String(), "Inspecting node... node-1") {
+		t.Errorf("expected the progress of the scan to be redirected, got %q", progress.String())
+	}
+	entries, err := session.Sample("node-1", "cilium_ct4_global", 2)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("expected 2 sampled entries, got %d: %v", len(entries), err)
+	}
+	if _, err := session.Sample("node-2", "cilium_ct4_global", 2); err == nil {
+		t.Errorf("expected an error for a node without an inspector pod")
+	}
+}
+
+// addPolicyEndpoint adds the CiliumEndpoint default/nginx with ID 42 on the
+// node.
+func addPolicyEndpoint(t *testing.T, s *Scanner, nodeName string) {
+	t.Helper()
+
+	node, _ := s.env.Client.CoreV1().Nodes().Get(context.Background(), nodeName, metav1.GetOptions{})
+	node.Status.Addresses = []corev1.NodeAddress{{Type: corev1.NodeInternalIP, Address: "10.0.0.1"}}
+	if _, err := s.env.Client.CoreV1().Nodes().Update(context.Background(), node, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	s.env.Dynamic = dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{ciliumendpoint.GVR: "CiliumEndpointList"},
+		&unstructured.Unstructured{Object: map[string]any{
+			"apiVersion": "cilium.io/v2",
+			"kind":       "CiliumEndpoint",
+			"metadata":   map[string]any{"namespace": "default", "name": "nginx"},
+			"status":     map[string]any{"id": int64(42), "networking": map[string]any{"node": "10.0.0.1"}},
+		}},
+	)
+}
+
+func TestRunPolicyMaps(t *testing.T) {
+	s, out := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_call_policy":  {maxEntries: 100, currentEntries: 1},
+		"cilium_ct4_global":   {maxEntries: 1000, currentEntries: 10},
+		"cilium_policy_00042": {maxEntries: 100, currentEntries: 95},
+		"cilium_policy_00007": {maxEntries: 100, currentEntries: 1},
+	}), "node-1")
+	s.opts.Output = output.Table
+	s.opts.PolicyMaps = true
+
+	addPolicyEndpoint(t, s, "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	if len(result.Items) != 3 {
+		t.Fatalf("expected 3 maps, got %+v", result.Items)
+	}
+	policy := findItem(t, result, "node-1", "cilium_policy_00042")
+	if policy.Status != "Critical" || policy.Endpoint == nil || policy.Endpoint.Namespace != "default" || policy.Endpoint.Name != "nginx" {
+		t.Errorf("unexpected policy map result %+v", policy)
+	}
+	if unresolved := findItem(t, result, "node-1", "cilium_policy_00007"); unresolved.Endpoint == nil || unresolved.Endpoint.ID != 7 {
+		t.Errorf("expected the endpoint ID of an unresolved policy map, got %+v", unresolved.Endpoint)
+	}
+	if !strings.Contains(out.String(), "cilium_policy_00042 (default/nginx)") {
+		t.Errorf("expected the pod of the policy map, got %s", out.String())
+	}
+}
+
+func TestSessionPolicyMaps(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_policy_00042": {maxEntries: 100, currentEntries: 1},
+	}), "node-1")
+	s.opts.PolicyMaps = true
+	addPolicyEndpoint(t, s, "node-1")
+
+	session, err := s.Open(context.Background(), check.NodeFilter{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer session.Close()
+
+	policy := findItem(t, session.Scan(), "node-1", "cilium_policy_00042")
+	if policy.Endpoint == nil || policy.Endpoint.Namespace != "default" || policy.Endpoint.Name != "nginx" {
+		t.Errorf("expected the policy map to be resolved to its pod, got %+v", policy.Endpoint)
+	}
+}
+
+func TestRunMapPatterns(t *testing.T) {
+	maps := map[string]fakeMap{
+		"cilium_ct4_global":      {maxEntries: 100, currentEntries: 1},
+		"cilium_ct_any4_global":  {maxEntries: 100, currentEntries: 1},
+		"cilium_lb4_services_v2": {maxEntries: 100, currentEntries: 1},
+		"cilium_calls_00042":     {maxEntries: 100, currentEntries: 1},
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"catalog", Options{}, []string{"cilium_ct4_global", "cilium_ct_any4_global", "cilium_lb4_services_v2"}},
+		{"patterns", Options{MapPatterns: []string{"cilium_ct*", "cilium_calls_*"}}, []string{"cilium_calls_00042", "cilium_ct4_global", "cilium_ct_any4_global"}},
+		{"all maps", Options{AllMaps: true}, []string{"cilium_calls_00042", "cilium_ct4_global", "cilium_ct_any4_global", "cilium_lb4_services_v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestScanner(t, bpftoolHandler(maps), "node-1")
+			s.opts.MapPatterns = tt.opts.MapPatterns
+			s.opts.AllMaps = tt.opts.AllMaps
+
+			if err := s.Run(check.NodeFilter{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			var got []string
+			for _, item := range s.Result().Items {
+				got = append(got, item.Map)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRunAllMapsSkipsArrays(t *testing.T) {
+	s, _ := newTestScanner(t, bpftoolHandler(map[string]fakeMap{
+		"cilium_calls_00042":    {maxEntries: 100, currentEntries: 100, mapType: "prog_array"},
+		"cilium_events":         {maxEntries: 4, currentEntries: 4, mapType: "perf_event_array"},
+		"cilium_runtime_config": {maxEntries: 256, currentEntries: 256, mapType: "array"},
+		"cilium_metrics":        {maxEntries: 1024, currentEntries: 1024, mapType: "percpu_array"},
+		"cilium_ct4_global":     {maxEntries: 100, currentEntries: 1},
+		"cilium_ipcache":        {maxEntries: 100, currentEntries: 1, mapType: "lpm_trie"},
+		"cilium_lxc":            {maxEntries: 100, currentEntries: 1, mapType: "hash"},
+	}), "node-1")
+	s.opts.AllMaps = true
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	var got []string
+	for _, item := range s.Result().Items {
+		got = append(got, item.Map+":"+string(item.Status))
+	}
+	if want := []string{"cilium_ct4_global:OK", "cilium_ipcache:OK", "cilium_lxc:OK"}; !slices.Equal(got, want) {
+		t.Errorf("expected only the hash maps %v, got %v", want, got)
+	}
+}
+
+func TestValidateMapPatterns(t *testing.T) {
+	s, _ := newTestScanner(t, nil, "node-1")
+	s.opts.MapPatterns = []string{"cilium_[ct"}
+	if err := s.Validate(); err == nil {
+		t.Errorf("expected an error for an invalid pattern")
+	}
+}
+
+func addAgentPod(t *testing.T, s *Scanner, nodeName string) *corev1.Pod {
+	t.Helper()
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "cilium-" + nodeName, Namespace: ciliumconfig.Namespace, Labels: map[string]string{"k8s-app": "cilium"}},
+		Spec: corev1.PodSpec{
+			NodeName: nodeName,
+			Containers: []corev1.Container{{
+				Name:         check.AgentContainer,
+				VolumeMounts: []corev1.VolumeMount{{Name: "bpf-maps", MountPath: bpffsMountPath}},
+			}},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	if err := s.env.Client.(*k8sfake.Clientset).Tracker().Add(pod); err != nil {
+		t.Fatal(err)
+	}
+	return pod
+}
+
+func TestRunAgentExec(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 100, currentEntries: 1}})
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if container != check.AgentContainer {
+			return "", fmt.Errorf("unexpected container %s", container)
+		}
+		if slices.Equal(cmd, lookupBpftoolCmd) {
+			return "/usr/local/bin/bpftool", nil
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+	addAgentPod(t, s, "node-1")
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.Status != "OK" || ct.Pod != "cilium-node-1" {
+		t.Errorf("expected the map to be inspected in the cilium-agent pod, got %+v", ct)
+	}
+	if _, err := s.env.Client.CoreV1().Namespaces().Get(context.Background(), inspectNS, metav1.GetOptions{}); err == nil {
+		t.Errorf("expected no inspector namespace to be created")
+	}
+}
+
+func TestRunAutoFallsBackToInspectorPod(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 100, currentEntries: 1}})
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if container == check.AgentContainer {
+			return "", fake.ExitError(1)
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+	s.opts.Source = SourceBpftool
+	addAgentPod(t, s, "node-1")
+	var created *corev1.Pod
+	s.env.Client.(*k8sfake.Clientset).PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created = action.(k8stesting.CreateAction).GetObject().(*corev1.Pod).DeepCopy()
+		return false, nil, nil
+	})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.Status != "OK" || ct.Pod != "bpf-inspector-node-1" {
+		t.Errorf("expected the map to be inspected in an inspector pod, got %+v", ct)
+	}
+	if want := []corev1.Toleration{{Operator: corev1.TolerationOpExists}}; created == nil || !slices.Equal(created.Spec.Tolerations, want) {
+		t.Errorf("expected the inspector pod to tolerate all taints, got %+v", created)
+	}
+}
+
+func TestRunAgentExecWithoutAgent(t *testing.T) {
+	s, _ := newTestScanner(t, nil, "node-1")
+	s.opts.Method = MethodAgentExec
+
+	if err := s.Run(check.NodeFilter{}); err == nil {
+		t.Errorf("expected an error without cilium-agent pods")
+	}
+}
+
+func TestRunEphemeralContainer(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 100, currentEntries: 1}})
+	var stopped atomic.Int32
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if !strings.HasPrefix(container, podNamePrefix+"-") {
+			return "", fmt.Errorf("unexpected container %s", container)
+		}
+		if slices.Equal(cmd, stopEphemeralCmd) {
+			stopped.Add(1)
+			return "", nil
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+	s.opts.Method = MethodEphemeralContainer
+	addAgentPod(t, s, "node-1")
+
+	kc := s.env.Client.(*k8sfake.Clientset)
+	kc.PrependReactor("update", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "ephemeralcontainers" {
+			return false, nil, nil
+		}
+		pod := action.(k8stesting.UpdateAction).GetObject().(*corev1.Pod)
+		for _, container := range pod.Spec.EphemeralContainers {
+			if container.VolumeMounts[0].Name != "bpf-maps" {
+				t.Errorf("unexpected volume mounts %+v", container.VolumeMounts)
+			}
+			pod.Status.EphemeralContainerStatuses = append(pod.Status.EphemeralContainerStatuses, corev1.ContainerStatus{
+				Name:  container.Name,
+				State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+			})
+		}
+		return true, pod, kc.Tracker().Update(action.GetResource(), pod, pod.Namespace)
+	})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.Status != "OK" || ct.Pod != "cilium-node-1" {
+		t.Errorf("expected the map to be inspected in the cilium-agent pod, got %+v", ct)
+	}
+	if stopped.Load() != 1 {
+		t.Errorf("expected the ephemeral container to be stopped once, got %d", stopped.Load())
+	}
+}
+
+func TestParseMethod(t *testing.T) {
+	if m, err := ParseMethod(""); err != nil || m != MethodAuto {
+		t.Errorf("expected auto for an empty method, got %q: %v", m, err)
+	}
+	if m, err := ParseMethod("ephemeral-container"); err != nil || m != MethodEphemeralContainer {
+		t.Errorf("unexpected method %q: %v", m, err)
+	}
+	if _, err := ParseMethod("ssh"); err == nil {
+		t.Errorf("expected an error for an unknown method")
+	}
+}
+
+func TestRunReusesEphemeralContainer(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 100, currentEntries: 1}})
+	var stopped atomic.Int32
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if container != "bpf-inspector-1" {
+			return "", fmt.Errorf("unexpected container %s", container)
+		}
+		if slices.Equal(cmd, stopEphemeralCmd) {
+			stopped.Add(1)
+			return "", nil
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+	s.opts.Method = MethodEphemeralContainer
+
+	pod := addAgentPod(t, s, "node-1")
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "bpf-inspector-0", Command: ephemeralCmd}},
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "bpf-inspector-1", Command: ephemeralCmd}},
+	}
+	pod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{Name: "bpf-inspector-0", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+		{Name: "bpf-inspector-1", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+	}
+	kc := s.env.Client.(*k8sfake.Clientset)
+	if err := kc.Tracker().Update(corev1.SchemeGroupVersion.WithResource("pods"), pod, pod.Namespace); err != nil {
+		t.Fatal(err)
+	}
+	kc.PrependReactor("update", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		t.Errorf("unexpected update of pod %s", action.(k8stesting.UpdateAction).GetObject().(*corev1.Pod).Name)
+		return true, nil, errors.New("unexpected update")
+	})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.Status != "OK" {
+		t.Errorf("expected the map to be inspected in the running container, got %+v", ct)
+	}
+	if stopped.Load() != 1 {
+		t.Errorf("expected the reused container to be stopped, got %d", stopped.Load())
+	}
+}
+
+func TestBpffsVolume(t *testing.T) {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{
+		Containers: []corev1.Container{{Name: check.AgentContainer}},
+		Volumes: []corev1.Volume{
+			{Name: "cilium-run", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run/cilium"}}},
+			{Name: "bpf-maps", VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/sys/fs/bpf/"}}},
+		},
+	}}
+	if got := bpffsVolume(pod); got != "bpf-maps" {
+		t.Errorf("expected the host path volume, got %q", got)
+	}
+
+	pod.Spec.Volumes = pod.Spec.Volumes[:1]
+	if got := bpffsVolume(pod); got != "" {
+		t.Errorf("expected no volume, got %q", got)
+	}
+}
+
+// ciliumDbgHandler emulates cilium-agent containers without bpftool that
+// report the pressure of cilium_ct4_global.
+func ciliumDbgHandler(pod *corev1.Pod, container string, cmd []string) (string, error) {
+	switch {
+	case container != check.AgentContainer:
+		return "", fmt.Errorf("unexpected container %s", container)
+	case slices.Equal(cmd, lookupBpftoolCmd):
+		return "", fake.ExitError(1)
+	case slices.Equal(cmd, ciliumdbg.Cmd):
+		return `{"status":{"bpf-maps":{"maps":[{"name":"TCP connection tracking","size":1000}]}},` +
+			`"metrics":[{"name":"cilium_bpf_map_pressure","labels":{"map_name":"ct4_global"},"value":0.85}]}`, nil
+	}
+	return "", fmt.Errorf("unexpected command %q", strings.Join(cmd, " "))
+}
+
+func TestRunCiliumDbg(t *testing.T) {
+	for _, method := range []Method{MethodAuto, MethodAgentExec} {
+		t.Run(string(method), func(t *testing.T) {
+			s, _ := newTestScanner(t, ciliumDbgHandler, "node-1")
+			s.opts.Method = method
+			addAgentPod(t, s, "node-1")
+
+			if err := s.Run(check.NodeFilter{}); err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+
+			result := s.Result()
+			ct := result.Items[0]
+			if ct.Map != "cilium_ct4_global" || ct.CountMethod != ciliumdbg.Method || ct.CurrentEntries != 850 || ct.MaxEntries != 1000 || ct.Status != "Warning" {
+				t.Errorf("unexpected ct result %+v", ct)
+			}
+			for _, item := range result.Items[1:] {
+				if item.Status != check.Unknown || item.Error != "not reported by cilium-dbg" {
+					t.Errorf("expected the maps without pressure metric to be Unknown, got %+v", item)
+				}
+				if m, _ := bpfmaps.Lookup(item.Map); m.Family == bpfmaps.IPv6 {
+					t.Errorf("unexpected map %s with IPv6 disabled", item.Map)
+				}
+			}
+			if snat := findItem(t, result, "node-1", "cilium_snat_v4_external"); snat.Pod != "cilium-node-1" {
+				t.Errorf("expected no inspector pod, got %s", snat.Pod)
+			}
+		})
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	s, _ := newTestScanner(t, nil, "node-1")
+	s.opts.Method = MethodInspectorPod
+	s.opts.Source = SourceCiliumDbg
+	if err := s.Validate(); err == nil {
+		t.Errorf("expected an error for cilium-dbg in inspector pods")
+	}
+}
+
+type proxyResponse string
+
+func (r proxyResponse) DoRaw(context.Context) ([]byte, error) {
+	return []byte(r), nil
+}
+
+func (r proxyResponse) Stream(context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(r))), nil
+}
+
+func TestRunMetricsSource(t *testing.T) {
+	var batchCmds [][]string
+	handler := bpftoolHandler(map[string]fakeMap{
+		"cilium_ct4_global": {maxEntries: 100, currentEntries: 1},
+		"cilium_ipcache":    {maxEntries: 100, currentEntries: 10},
+	})
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		if slices.Equal(cmd, lookupBpftoolCmd) {
+			return "/usr/local/bin/bpftool", nil
+		}
+		if _, ok := batchArgs(cmd); ok {
+			batchCmds = append(batchCmds, cmd)
+		}
+		return handler(pod, container, cmd)
+	}, "node-1")
+	s.opts.Source = SourceMetrics
+	addAgentPod(t, s, "node-1")
+
+	var scraped []string
+	s.env.Client.(*k8sfake.Clientset).AddProxyReactor("pods", func(action k8stesting.Action) (bool, restclient.ResponseWrapper, error) {
+		proxy := action.(k8stesting.ProxyGetAction)
+		scraped = append(scraped, proxy.GetName()+":"+proxy.GetPort()+proxy.GetPath())
+		return true, proxyResponse("# TYPE cilium_bpf_map_pressure gauge\n" +
+			`cilium_bpf_map_pressure{map_name="ct4_global"} 0.95` + "\n"), nil
+	})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if !slices.Equal(scraped, []string{"cilium-node-1:9962/metrics"}) {
+		t.Errorf("unexpected scrapes %v", scraped)
+	}
+	if len(batchCmds) != 1 || !slices.Equal(batchCmds[0][len(batchCmds[0])-2:], []string{"--", "cilium_ct4_global"}) {
+		t.Errorf("expected bpftool to skip the maps covered by the metrics, got %q", batchCmds)
+	}
+
+	result := s.Result()
+	if ct := findItem(t, result, "node-1", "cilium_ct4_global"); ct.Status != "Critical" || ct.Usage != 95 || ct.MaxEntries != 0 || ct.CountMethod != metricsMethod || ct.Error != "" {
+		t.Errorf("unexpected ct result %+v", ct)
+	}
+	if ipcache := findItem(t, result, "node-1", "cilium_ipcache"); ipcache.Status != "OK" || ipcache.CurrentEntries != 10 || ipcache.CountMethod != batch.MethodDump {
+		t.Errorf("expected ipcache to be counted with bpftool, got %+v", ipcache)
+	}
+}
+
+func TestRunInspectorOptions(t *testing.T) {
+	handler := bpftoolHandler(map[string]fakeMap{"cilium_ct4_global": {maxEntries: 100, currentEntries: 1}})
+	var created *corev1.Pod
+	s, _ := newTestScanner(t, handler, "node-1")
+	s.opts.Method = MethodInspectorPod
+	s.opts.Inspector = Inspector{
+		Image:            "registry.example.com/bpftool:v7.5.0",
+		ImagePullPolicy:  corev1.PullIfNotPresent,
+		ImagePullSecrets: []string{"regcred"},
+		Resources: corev1.ResourceRequirements{
+			Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+		},
+		PriorityClassName: "system-node-critical",
+		Tolerations:       []corev1.Toleration{{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+	}
+	kc := s.env.Client.(*k8sfake.Clientset)
+	kc.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created = action.(k8stesting.CreateAction).GetObject().(*corev1.Pod).DeepCopy()
+		return false, nil, nil
+	})
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "regcred", Namespace: ciliumconfig.Namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{corev1.DockerConfigJsonKey: []byte("{}")},
+	}
+	if err := kc.Tracker().Add(secret); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if created == nil {
+		t.Fatalf("expected an inspector pod to be created")
+	}
+	container := created.Spec.Containers[0]
+	if container.Image != "registry.example.com/bpftool:v7.5.0" || container.ImagePullPolicy != corev1.PullIfNotPresent {
+		t.Errorf("unexpected image %s with pull policy %s", container.Image, container.ImagePullPolicy)
+	}
+	if limit := container.Resources.Limits[corev1.ResourceMemory]; limit.String() != "128Mi" {
+		t.Errorf("unexpected resources %+v", container.Resources)
+	}
+	if created.Spec.PriorityClassName != "system-node-critical" || !slices.Equal(created.Spec.Tolerations, s.opts.Inspector.Tolerations) ||
+		len(created.Spec.ImagePullSecrets) != 1 || created.Spec.ImagePullSecrets[0].Name != "regcred" {
+		t.Errorf("unexpected pod spec %+v", created.Spec)
+	}
+	if ct := findItem(t, s.Result(), "node-1", "cilium_ct4_global"); ct.Status != "OK" {
+		t.Errorf("unexpected ct result %+v", ct)
+	}
+}
+
+func TestRunInspectorImagePullFailure(t *testing.T) {
+	var execs atomic.Int32
+	s, _ := newTestScanner(t, func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+		execs.Add(1)
+		return "", fmt.Errorf("unexpected command %q", strings.Join(cmd, " "))
+	}, "node-1", "node-2")
+	s.opts.Method = MethodInspectorPod
+
+	var creates atomic.Int32
+	kc := s.env.Client.(*k8sfake.Clientset)
+	kc.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		creates.Add(1)
+		return false, nil, nil
+	})
+	kc.PrependReactor("get", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		name := action.(k8stesting.GetAction).GetName()
+		return true, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: inspectNS},
+			Status: corev1.PodStatus{
+				Phase: corev1.PodPending,
+				ContainerStatuses: []corev1.ContainerStatus{{
+					Name:  containerName,
+					Image: defaultInspectorImage,
+					State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"}},
+				}},
+			},
+		}, nil
+	})
+
+	err := s.Run(check.NodeFilter{})
+	if !errors.Is(err, errImagePull) {
+		t.Fatalf("expected an image pull error, got %v", err)
+	}
+	if creates.Load() != 1 || execs.Load() != 0 {
+		t.Errorf("expected the scan to stop after the first inspector pod, got %d pods and %d execs", creates.Load(), execs.Load())
+	}
+}
+
+func TestLoadInspectorFile(t *testing.T) {
+	filename := path.Join(t.TempDir(), "inspector.yaml")
+	content := "image: registry.example.com/bpftool:v7.5.0\nresources:\n  limits:\n    memory: 128Mi\n"
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	inspector, err := LoadInspectorFile(filename)
+	if err != nil {
+		t.Fatalf("LoadInspectorFile: %v", err)
+	}
+	cpu, memory := inspector.Resources.Limits[corev1.ResourceCPU], inspector.Resources.Limits[corev1.ResourceMemory]
+	if inspector.Image != "registry.example.com/bpftool:v7.5.0" || cpu.String() != defaultCPULimit || memory.String() != "128Mi" {
+		t.Errorf("expected the file to be merged into the defaults, got %+v", inspector)
+	}
+
+	inspector.ImagePullPolicy = "Sometimes"
+	if err := inspector.Validate(); err == nil {
+		t.Errorf("expected an error for an unknown pull policy")
+	}
+}
+
+func TestParseToleration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    corev1.Toleration
+		wantErr bool
+	}{
+		{in: "dedicated", want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists}},
+		{in: "dedicated=infra:NoSchedule", want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpEqual, Value: "infra", Effect: corev1.TaintEffectNoSchedule}},
+		{in: "dedicated:NoExecute", want: corev1.Toleration{Key: "dedicated", Operator: corev1.TolerationOpExists, Effect: corev1.TaintEffectNoExecute}},
+		{in: "=infra", wantErr: true},
+		{in: "dedicated:Sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseToleration(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseToleration(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
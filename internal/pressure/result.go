@@ -0,0 +1,203 @@
+package pressure
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumendpoint"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+)
+
+// ResultAPIVersion is the version of the machine-readable result schema.
+// It is bumped whenever a field is removed or its meaning changes.
+const ResultAPIVersion = "kubectl-cilium/v1alpha1"
+
+const resultKind = "BPFMapPressureResult"
+
+// Result is the machine-readable form of a bpf-map-pressure scan.
+type Result struct {
+	APIVersion string      `json:"apiVersion"`
+	Kind       string      `json:"kind"`
+	Items      []MapResult `json:"items"`
+}
+
+// MapResult describes the pressure of a single BPF map on a single node.
+type MapResult struct {
+	Node           string               `json:"node"`
+	Pod            string               `json:"pod,omitempty"`
+	Map            string               `json:"map"`
+	ID             int                  `json:"id,omitempty"`
+	Type           string               `json:"type,omitempty"`
+	KeySize        int                  `json:"keySize,omitempty"`
+	ValueSize      int                  `json:"valueSize,omitempty"`
+	Flags          int                  `json:"flags"`
+	Memlock        int64                `json:"memlock,omitempty"`
+	MaxEntries     int                  `json:"maxEntries"`
+	CurrentEntries int                  `json:"currentEntries"`
+	Usage          float64              `json:"usage"`
+	Sizing         *ciliumconfig.Sizing `json:"sizing,omitempty"`
+	// Endpoint is the endpoint of a per-endpoint policy map.
+	Endpoint     *ciliumendpoint.Endpoint `json:"endpoint,omitempty"`
+	CountMethod  string                   `json:"countMethod,omitempty"`
+	CountSeconds float64                  `json:"countSeconds,omitempty"`
+	Status       check.Status             `json:"status"`
+	Error        string                   `json:"error,omitempty"`
+}
+
+// EntriesLabel shows the entries and size of the map in tables, or - if only
+// its usage is known.
+func (r MapResult) EntriesLabel() string {
+	if r.MaxEntries == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", r.CurrentEntries, r.MaxEntries)
+}
+
+// MapLabel names the map in tables. Policy maps are followed by the pod of
+// their endpoint when it is known.
+func (r MapResult) MapLabel() string {
+	if r.Endpoint == nil || r.Endpoint.Name == "" {
+		return r.Map
+	}
+	return fmt.Sprintf("%s (%s/%s)", r.Map, r.Endpoint.Namespace, r.Endpoint.Name)
+}
+
+// Result returns the outcome of the last Run, ordered by status, node and map name.
+func (s *Scanner) Result() *Result {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type entry struct {
+		status check.Status
+		item   MapResult
+	}
+	var entries []entry
+	for nodeName, node := range s.nodes {
+		for mapName, bpfMap := range node.bpfMaps {
+			var sizing *ciliumconfig.Sizing
+			if s.ciliumConfig != nil && bpfMap.status != check.Unknown && bpfMap.maxEntries > 0 {
+				warning := s.opts.Thresholds.For(mapName).Warning
+				sizing = s.ciliumConfig.Explain(mapName, bpfMap.maxEntries, bpfMap.currentEntries, warning, node.memory)
+			}
+			var endpoint *ciliumendpoint.Endpoint
+			if id, ok := bpfmaps.PolicyEndpointID(mapName); ok {
+				ep, found := s.endpoints.Lookup(node.addresses, id)
+				if !found {
+					ep = ciliumendpoint.Endpoint{ID: id}
+				}
+				endpoint = &ep
+			}
+			entries = append(entries, entry{
+				status: bpfMap.status,
+				item: MapResult{
+					Node:           nodeName,
+					Pod:            node.target.podName(),
+					Map:            mapName,
+					ID:             bpfMap.info.ID,
+					Type:           bpfMap.info.Type,
+					KeySize:        bpfMap.info.KeySize,
+					ValueSize:      bpfMap.info.ValueSize,
+					Flags:          bpfMap.info.Flags,
+					Memlock:        bpfMap.info.Memlock,
+					MaxEntries:     bpfMap.maxEntries,
+					CurrentEntries: bpfMap.currentEntries,
+					Usage:          bpfMap.usage,
+					Sizing:         sizing,
+					Endpoint:       endpoint,
+					CountMethod:    bpfMap.countMethod,
+					CountSeconds:   bpfMap.countDuration.Seconds(),
+					Status:         bpfMap.status,
+					Error:          bpfMap.errMsg,
+				},
+			})
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.status != b.status {
+			return a.status.Rank() < b.status.Rank()
+		}
+		if a.item.Node != b.item.Node {
+			return a.item.Node < b.item.Node
+		}
+		return a.item.Map < b.item.Map
+	})
+
+	items := make([]MapResult, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, e.item)
+	}
+
+	return &Result{
+		APIVersion: ResultAPIVersion,
+		Kind:       resultKind,
+		Items:      items,
+	}
+}
+
+// Findings returns a finding per map, with its sizing hint as remediation.
+func (r *Result) Findings() []check.Finding {
+	findings := make([]check.Finding, 0, len(r.Items))
+	for _, item := range r.Items {
+		finding := check.Finding{
+			Node:    item.Node,
+			Subject: item.MapLabel(),
+			Status:  item.Status,
+			Usage:   item.Usage,
+			Error:   item.Error,
+		}
+		if item.Sizing != nil && (item.Status == check.Warning || item.Status == check.Critical) {
+			finding.Hint = item.Sizing.Hint
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// Table renders the maps with the sizing hints of the pressured maps as notes.
+func (r *Result) Table(wide bool) check.Table {
+	t := check.Table{Header: []string{"STATUS", "NODE", "MAP", "USAGE", "CURRENT/MAX"}}
+	if wide {
+		t.Header = []string{"STATUS", "NODE", "POD", "MAP", "ID", "TYPE", "KEY/VALUE", "FLAGS", "MEMLOCK", "USAGE", "CURRENT/MAX", "SIZING", "COUNTED-BY", "COUNT-TIME", "ERROR"}
+	}
+
+	var hints []string
+	warnings := 0
+	for _, item := range r.Items {
+		status := item.Status.Label()
+		if item.Status == check.Warning || item.Status == check.Critical {
+			warnings++
+			if item.Sizing != nil && item.Sizing.Hint != "" {
+				hints = append(hints, fmt.Sprintf("%s %s/%s (%s): %s", status, item.Node, item.MapLabel(), describeSizing(item.Sizing), item.Sizing.Hint))
+			}
+		}
+		switch {
+		case wide:
+			t.Rows = append(t.Rows, []string{status, item.Node, item.Pod, item.MapLabel(), fmt.Sprint(item.ID), item.Type,
+				fmt.Sprintf("%d/%d", item.KeySize, item.ValueSize), fmt.Sprintf("%#x", item.Flags), output.Bytes(item.Memlock),
+				fmt.Sprintf("%.2f%%", item.Usage), item.EntriesLabel(), sizingColumn(item.Sizing),
+				item.CountMethod, fmt.Sprintf("%.3fs", item.CountSeconds), item.Error})
+		case item.Status == check.Unknown:
+			t.Rows = append(t.Rows, []string{status, item.Node, item.MapLabel(), "ERR:" + item.Error})
+		default:
+			t.Rows = append(t.Rows, []string{status, item.Node, item.MapLabel(), fmt.Sprintf("%.2f%%", item.Usage), item.EntriesLabel()})
+		}
+	}
+
+	switch {
+	case len(hints) > 0:
+		note := "\n\033[38;5;208mTo bring the maps under the warning threshold, consider changing the cilium-agent configuration:\n"
+		for _, hint := range hints {
+			note += fmt.Sprintf("  %s\n", hint)
+		}
+		t.Notes = append(t.Notes, note+"\033[0m\n")
+	case warnings > 0:
+		t.Notes = append(t.Notes, "\n\033[38;5;208mIf you see [Critical] or [Warning] status in the output and encounter network issues,\n"+
+			"Please consider increasing --bpf-map-dynamic-size-ratio in cilium-agent configuration.\033[0m\n\n")
+	}
+	return t
+}
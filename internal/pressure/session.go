@@ -0,0 +1,149 @@
+package pressure
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// sampleBytes bounds the dump output read when sampling a map.
+const sampleBytes = 64 << 10
+
+// Session keeps the inspector pods or containers of the scanned nodes alive,
+// so that the maps can be scanned and sampled repeatedly until Close is called.
+type Session struct {
+	s          *Scanner
+	nodes      []corev1.Node
+	ctx        context.Context
+	cancel     context.CancelFunc
+	shutdownWG *sync.WaitGroup
+}
+
+// Open starts a session on the nodes selected by the filter. The session is
+// closed once parentCtx is cancelled, e.g. by a signal.
+func (s *Scanner) Open(parentCtx context.Context, nodeFilter check.NodeFilter) (*Session, error) {
+	nodes, err := s.listNodes(nodeFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	s.loadCiliumConfig()
+	s.loadEndpoints()
+
+	ctx, cancel := context.WithCancel(parentCtx)
+	err = s.prepareMethod(ctx, nodes)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	shutdownWG := &sync.WaitGroup{}
+	shutdownWG.Add(1)
+	go s.startShutdownHandler(ctx, shutdownWG, nodes)
+
+	err = s.checkInspectorImage(ctx, nodes)
+	if err != nil {
+		cancel()
+		shutdownWG.Wait()
+		return nil, err
+	}
+
+	return &Session{
+		s:          s,
+		nodes:      nodes,
+		ctx:        ctx,
+		cancel:     cancel,
+		shutdownWG: shutdownWG,
+	}, nil
+}
+
+// Scan inspects the nodes of the session and returns the outcome.
+func (ss *Session) Scan() *Result {
+	ss.s.inspectNodes(ss.ctx, ss.nodes, true)
+	return ss.s.Result()
+}
+
+// SetProgress redirects the progress messages of the following scans, e.g. to
+// io.Discard while they would garble a full-screen UI.
+func (ss *Session) SetProgress(w io.Writer) {
+	ss.s.progress.set(w)
+}
+
+// progressWriter writes the progress messages to a writer that can be
+// replaced, or muted between the scans of a watch, while the cleanup of an
+// interrupted session writes to it.
+type progressWriter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	muted bool
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.muted {
+		return len(b), nil
+	}
+	return p.w.Write(b)
+}
+
+func (p *progressWriter) set(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.w = w
+}
+
+func (p *progressWriter) mute(muted bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.muted = muted
+}
+
+// Done is closed when the context of the session is cancelled or the session
+// is closed.
+func (ss *Session) Done() <-chan struct{} {
+	return ss.ctx.Done()
+}
+
+// NodeLabels returns the labels of the nodes of the session by node name.
+func (ss *Session) NodeLabels() map[string]map[string]string {
+	labels := make(map[string]map[string]string, len(ss.nodes))
+	for _, node := range ss.nodes {
+		labels[node.Name] = node.Labels
+	}
+	return labels
+}
+
+// Sample returns up to limit entries from the start of a map of a node.
+// The node must have been scanned.
+func (ss *Session) Sample(nodeName, mapName string, limit int) ([]bpftool.Entry, error) {
+	ss.s.mu.RLock()
+	n, ok := ss.s.nodes[nodeName]
+	ss.s.mu.RUnlock()
+	if !ok || n.target == nil {
+		return nil, fmt.Errorf("node %s was not inspected", nodeName)
+	}
+	if ss.s.source == SourceCiliumDbg {
+		return nil, fmt.Errorf("sampling entries requires bpftool, the maps are read from %s", SourceCiliumDbg)
+	}
+
+	out, err := ss.s.execCmd(ss.ctx, n.target, bpftool.MapSampleCmd(path.Join(globalsDir, mapName), sampleBytes))
+	if err != nil {
+		return nil, err
+	}
+	return bpftool.SampleEntries(out, limit)
+}
+
+// Close deletes the inspector pods, or stops the ephemeral containers, and
+// waits for the cleanup to complete.
+func (ss *Session) Close() {
+	ss.cancel()
+	ss.shutdownWG.Wait()
+}
@@ -0,0 +1,222 @@
+// Package recommend computes the cilium-agent map sizing that keeps every map
+// of every node under a target usage.
+package recommend
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+)
+
+// ResultAPIVersion is the version of the machine-readable result schema.
+const ResultAPIVersion = "kubectl-cilium/v1alpha1"
+
+const (
+	resultKind = "SizingRecommendation"
+
+	DefaultTargetUsage = 0.7
+	DefaultHeadroom    = 0.2
+)
+
+type Options struct {
+	// TargetUsage is the usage ratio every map should stay below.
+	TargetUsage float64
+	// Headroom is the growth of the current entries to plan for, e.g. 0.2 for 20%.
+	Headroom float64
+}
+
+func (o Options) Validate() error {
+	if o.TargetUsage <= 0 || o.TargetUsage > 1 {
+		return fmt.Errorf("target usage %v must be in (0, 1]", o.TargetUsage)
+	}
+	if o.Headroom < 0 {
+		return fmt.Errorf("headroom %v must not be negative", o.Headroom)
+	}
+	return nil
+}
+
+// Recommendation is the machine-readable result of the recommend command.
+type Recommendation struct {
+	APIVersion  string   `json:"apiVersion"`
+	Kind        string   `json:"kind"`
+	TargetUsage float64  `json:"targetUsage"`
+	Headroom    float64  `json:"headroom"`
+	Options     []Option `json:"options"`
+	Nodes       []Node   `json:"nodes"`
+	Notes       []string `json:"notes,omitempty"`
+}
+
+// Option is the minimum value of a cilium-agent option.
+type Option struct {
+	Name    string  `json:"name"`
+	Current float64 `json:"current"`
+	Minimum float64 `json:"minimum"`
+	// Node and Map point to the map that needs the largest value.
+	Node  string  `json:"node"`
+	Map   string  `json:"map"`
+	Usage float64 `json:"usage"`
+}
+
+// Node is the kernel memory a node would additionally need for the maps if
+// every option is raised to its minimum.
+type Node struct {
+	Name        string `json:"name"`
+	ExtraMemory int64  `json:"extraMemory"`
+}
+
+// Compute derives the recommendation from a bpf-map-pressure result. Maps
+// without sizing information, e.g. because cilium-config could not be read,
+// or without entries, e.g. read from the agent metrics, are skipped and
+// reported in Notes.
+func Compute(result *pressure.Result, opts Options) *Recommendation {
+	rec := &Recommendation{
+		APIVersion:  ResultAPIVersion,
+		Kind:        resultKind,
+		TargetUsage: opts.TargetUsage,
+		Headroom:    opts.Headroom,
+		Options:     []Option{},
+		Nodes:       []Node{},
+	}
+
+	options := map[string]*Option{}
+	skipped, usageOnly := 0, 0
+	for _, item := range result.Items {
+		if item.Status == check.Unknown {
+			continue
+		}
+		if item.MaxEntries <= 0 {
+			usageOnly++
+			continue
+		}
+		if item.Sizing == nil {
+			skipped++
+			continue
+		}
+
+		required := requiredEntries(item.CurrentEntries, opts)
+		if required > ciliumconfig.LimitTableMax {
+			rec.Notes = append(rec.Notes, fmt.Sprintf("%s/%s needs %d entries, more than the maximum map size %d",
+				item.Node, item.Map, required, ciliumconfig.LimitTableMax))
+			required = ciliumconfig.LimitTableMax
+		}
+
+		name, current, minimum := item.Sizing.Option, float64(item.MaxEntries), float64(required)
+		if item.Sizing.Mode == ciliumconfig.Dynamic {
+			name = ciliumconfig.DynamicSizeRatioKey
+			current = item.Sizing.DynamicSizeRatio
+			minimum = ciliumconfig.ScaleRatio(current, item.MaxEntries, required)
+		}
+
+		opt, ok := options[name]
+		if !ok {
+			opt = &Option{Name: name, Current: current}
+			options[name] = opt
+		}
+		if !ok || minimum > opt.Minimum {
+			opt.Minimum = minimum
+			opt.Node = item.Node
+			opt.Map = item.Map
+			opt.Usage = item.Usage
+		}
+	}
+
+	for _, opt := range options {
+		rec.Options = append(rec.Options, *opt)
+	}
+	sort.Slice(rec.Options, func(i, j int) bool {
+		return rec.Options[i].Name < rec.Options[j].Name
+	})
+
+	rec.Nodes = extraMemory(result, options)
+	if skipped > 0 {
+		rec.Notes = append(rec.Notes, fmt.Sprintf("%d maps were skipped because their sizing is unknown", skipped))
+	}
+	if usageOnly > 0 {
+		rec.Notes = append(rec.Notes, fmt.Sprintf("%d maps were skipped because only their usage is known, e.g. from the agent metrics; scan them with --source=bpftool", usageOnly))
+	}
+	return rec
+}
+
+// requiredEntries returns the map size that keeps the current entries plus
+// headroom under the target usage.
+func requiredEntries(currentEntries int, opts Options) int {
+	planned := int(float64(currentEntries) * (1 + opts.Headroom))
+	return ciliumconfig.RequiredMaxEntries(planned, opts.TargetUsage)
+}
+
+// extraMemory estimates, per node, the memory of the additional entries from
+// the key and value sizes of each map. Options that are already large enough
+// are left unchanged.
+func extraMemory(result *pressure.Result, options map[string]*Option) []Node {
+	extra := map[string]int64{}
+	for _, item := range result.Items {
+		if item.Status == check.Unknown || item.Sizing == nil || item.MaxEntries <= 0 {
+			continue
+		}
+		if _, ok := extra[item.Node]; !ok {
+			extra[item.Node] = 0
+		}
+
+		newMax := item.MaxEntries
+		if item.Sizing.Mode == ciliumconfig.Dynamic {
+			opt := options[ciliumconfig.DynamicSizeRatioKey]
+			if opt.Minimum > opt.Current {
+				newMax = min(int(float64(item.MaxEntries)*opt.Minimum/opt.Current), ciliumconfig.LimitTableMax)
+			}
+		} else if opt := options[item.Sizing.Option]; int(opt.Minimum) > newMax {
+			newMax = int(opt.Minimum)
+		}
+
+		extra[item.Node] += int64(newMax-item.MaxEntries) * int64(item.KeySize+item.ValueSize)
+	}
+
+	nodes := make([]Node, 0, len(extra))
+	for name, bytes := range extra {
+		nodes = append(nodes, Node{Name: name, ExtraMemory: bytes})
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].ExtraMemory != nodes[j].ExtraMemory {
+			return nodes[i].ExtraMemory > nodes[j].ExtraMemory
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes
+}
+
+// Print renders the recommendation in the given format.
+func Print(w io.Writer, format output.Format, rec *Recommendation) error {
+	if format.IsStructured() {
+		return output.Encode(w, format, rec)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(tw, "\nOPTION\tCURRENT\tMINIMUM\tACTION\tDRIVEN-BY\n")
+	for _, opt := range rec.Options {
+		action := "keep"
+		if opt.Minimum > opt.Current {
+			action = "increase"
+		}
+		fmt.Fprintf(tw, "%s\t%g\t%g\t%s\t%s/%s (%.2f%%)\n", opt.Name, opt.Current, opt.Minimum, action, opt.Node, opt.Map, opt.Usage)
+	}
+	fmt.Fprintf(tw, "\nNODE\tEXTRA-MEMORY\n")
+	for _, node := range rec.Nodes {
+		fmt.Fprintf(tw, "%s\t%s\n", node.Name, output.Bytes(node.ExtraMemory))
+	}
+	err := tw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush tab writer: %w", err)
+	}
+
+	fmt.Fprintf(w, "\nMinimum values keep every map under %.0f%% usage with %.0f%% headroom for growth.\n",
+		rec.TargetUsage*100, rec.Headroom*100)
+	for _, note := range rec.Notes {
+		fmt.Fprintf(w, "\033[38;5;208mNote: %s\033[0m\n", note)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package recommend
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/ciliumconfig"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+)
+
+func dynamic(ratio float64) *ciliumconfig.Sizing {
+	return &ciliumconfig.Sizing{Mode: ciliumconfig.Dynamic, Option: ciliumconfig.CTGlobalTCPMaxKey, DynamicSizeRatio: ratio}
+}
+
+func static(option string) *ciliumconfig.Sizing {
+	return &ciliumconfig.Sizing{Mode: ciliumconfig.Static, Option: option}
+}
+
+func TestCompute(t *testing.T) {
+	result := &pressure.Result{Items: []pressure.MapResult{
+		{Node: "node-1", Map: "cilium_ct4_global", KeySize: 14, ValueSize: 56, MaxEntries: 100000, CurrentEntries: 70000, Usage: 70, Sizing: dynamic(0.0025), Status: "Warning"},
+		{Node: "node-2", Map: "cilium_ct4_global", KeySize: 14, ValueSize: 56, MaxEntries: 200000, CurrentEntries: 20000, Usage: 10, Sizing: dynamic(0.0025), Status: "OK"},
+		{Node: "node-1", Map: "cilium_nodeport_neigh4", KeySize: 16, ValueSize: 24, MaxEntries: 1000, CurrentEntries: 100, Usage: 10, Sizing: static(ciliumconfig.NeighGlobalMaxKey), Status: "OK"},
+		{Node: "node-2", Map: "cilium_snat_v4_external", MaxEntries: 1000, CurrentEntries: 10, Status: "OK"},
+		{Node: "node-3", Map: "cilium_ct4_global", Status: "Unknown"},
+		{Node: "node-3", Map: "cilium_lb4_services_v2", Usage: 95, Status: "Critical"},
+	}}
+
+	rec := Compute(result, Options{TargetUsage: 0.7, Headroom: 0.2})
+
+	if len(rec.Options) != 2 {
+		t.Fatalf("expected 2 options, got %+v", rec.Options)
+	}
+	ratio, neigh := rec.Options[0], rec.Options[1]
+	if ratio.Name != ciliumconfig.DynamicSizeRatioKey || ratio.Current != 0.0025 || ratio.Minimum != 0.0031 || ratio.Node != "node-1" {
+		t.Errorf("unexpected ratio option %+v", ratio)
+	}
+	if neigh.Name != ciliumconfig.NeighGlobalMaxKey || neigh.Minimum != 173 || neigh.Minimum > neigh.Current {
+		t.Errorf("unexpected neigh option %+v", neigh)
+	}
+
+	// The ratio grows from 0.0025 to 0.0031, i.e. node-1 from 100000 to 124000
+	// entries and node-2 from 200000 to 248000. The static neigh map is already
+	// large enough.
+	if len(rec.Nodes) != 2 {
+		t.Fatalf("expected 2 nodes, got %+v", rec.Nodes)
+	}
+	if rec.Nodes[0].Name != "node-2" || rec.Nodes[0].ExtraMemory != 48000*70 {
+		t.Errorf("unexpected node-2 memory %+v", rec.Nodes[0])
+	}
+	if rec.Nodes[1].Name != "node-1" || rec.Nodes[1].ExtraMemory != 24000*70 {
+		t.Errorf("unexpected node-1 memory %+v", rec.Nodes[1])
+	}
+
+	if len(rec.Notes) != 2 || !strings.Contains(rec.Notes[0], "1 maps were skipped because their sizing") || !strings.Contains(rec.Notes[1], "1 maps were skipped because only their usage") {
+		t.Errorf("expected notes about the skipped maps, got %v", rec.Notes)
+	}
+}
+
+func TestComputeOverLimit(t *testing.T) {
+	result := &pressure.Result{Items: []pressure.MapResult{
+		{Node: "node-1", Map: "cilium_snat_v4_external", MaxEntries: 1 << 24, CurrentEntries: 1 << 24, Sizing: static(ciliumconfig.NATGlobalMaxKey), Status: "Critical"},
+	}}
+
+	rec := Compute(result, Options{TargetUsage: 0.7, Headroom: 0.2})
+	if rec.Options[0].Minimum != ciliumconfig.LimitTableMax {
+		t.Errorf("expected the minimum to be capped, got %+v", rec.Options[0])
+	}
+	if len(rec.Notes) != 1 || !strings.Contains(rec.Notes[0], "more than the maximum map size") {
+		t.Errorf("expected a note about the map size limit, got %v", rec.Notes)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, opts := range []Options{{TargetUsage: 0, Headroom: 0.2}, {TargetUsage: 1.1, Headroom: 0.2}, {TargetUsage: 0.7, Headroom: -0.1}} {
+		if opts.Validate() == nil {
+			t.Errorf("expected an error for %+v", opts)
+		}
+	}
+	if err := (Options{TargetUsage: DefaultTargetUsage, Headroom: DefaultHeadroom}).Validate(); err != nil {
+		t.Errorf("unexpected error for the defaults: %v", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	rec := &Recommendation{
+		TargetUsage: 0.7,
+		Headroom:    0.2,
+		Options:     []Option{{Name: ciliumconfig.DynamicSizeRatioKey, Current: 0.0025, Minimum: 0.0031, Node: "node-1", Map: "cilium_ct4_global", Usage: 70}},
+		Nodes:       []Node{{Name: "node-1", ExtraMemory: 24000 * 70}},
+	}
+
+	var out bytes.Buffer
+	if err := Print(&out, output.Table, rec); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	for _, want := range []string{"bpf-map-dynamic-size-ratio", "increase", "node-1/cilium_ct4_global", "1.6MiB", "under 70% usage with 20% headroom"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output, got %s", want, out.String())
+		}
+	}
+}
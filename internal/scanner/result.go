@@ -0,0 +1,133 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+)
+
+// ResultAPIVersion is the version of the machine-readable result schema.
+// It is bumped whenever a field is removed or its meaning changes.
+const ResultAPIVersion = "kubectl-cilium/v1alpha1"
+
+const (
+	resultKind = "SNATEvictionResult"
+	snatMap    = "cilium_snat_v4_external"
+)
+
+// Result is the machine-readable form of a snat-eviction scan.
+type Result struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Items      []NodeResult `json:"items"`
+}
+
+// NodeResult describes the SNAT map usage of a single node.
+type NodeResult struct {
+	Node           string       `json:"node"`
+	Pod            string       `json:"pod"`
+	Map            string       `json:"map"`
+	ID             int          `json:"id,omitempty"`
+	Type           string       `json:"type,omitempty"`
+	KeySize        int          `json:"keySize,omitempty"`
+	ValueSize      int          `json:"valueSize,omitempty"`
+	Flags          int          `json:"flags"`
+	Memlock        int64        `json:"memlock,omitempty"`
+	MaxEntries     int          `json:"maxEntries"`
+	CurrentEntries int          `json:"currentEntries"`
+	Usage          float64      `json:"usage"`
+	Status         check.Status `json:"status"`
+	Error          string       `json:"error,omitempty"`
+}
+
+// snatHint is the remediation of a node at risk of SNAT map eviction.
+const snatHint = "drain and reboot the node, see https://github.com/cilium/cilium/pull/37747"
+
+// Result returns the outcome of the last Run. Critical and Warning nodes come first,
+// each group ordered by usage in descending order.
+func (s *Scanner) Result() *Result {
+	s.mu.Lock()
+	nodes := append([]NodeInfo(nil), s.nodes...)
+	s.mu.Unlock()
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := nodes[i], nodes[j]
+		if a.Status != b.Status {
+			return a.Status.Rank() < b.Status.Rank()
+		}
+		if a.Usage != b.Usage {
+			return a.Usage > b.Usage
+		}
+		return a.NodeName < b.NodeName
+	})
+
+	items := []NodeResult{}
+	for _, node := range nodes {
+		items = append(items, NodeResult{
+			Node:           node.NodeName,
+			Pod:            node.PodName,
+			Map:            snatMap,
+			ID:             node.Info.ID,
+			Type:           node.Info.Type,
+			KeySize:        node.Info.KeySize,
+			ValueSize:      node.Info.ValueSize,
+			Flags:          node.Info.Flags,
+			Memlock:        node.Info.Memlock,
+			MaxEntries:     node.MaxCnt,
+			CurrentEntries: node.CurrentCnt,
+			Usage:          node.Usage,
+			Status:         node.Status,
+			Error:          node.Err,
+		})
+	}
+
+	return &Result{
+		APIVersion: ResultAPIVersion,
+		Kind:       resultKind,
+		Items:      items,
+	}
+}
+
+// Findings returns a finding per node, with a drain and reboot as remediation.
+func (r *Result) Findings() []check.Finding {
+	findings := make([]check.Finding, 0, len(r.Items))
+	for _, item := range r.Items {
+		finding := check.Finding{
+			Node:    item.Node,
+			Subject: item.Map,
+			Status:  item.Status,
+			Usage:   item.Usage,
+			Error:   item.Error,
+		}
+		if item.Status == check.Warning || item.Status == check.Critical {
+			finding.Hint = snatHint
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// Table renders the SNAT map of every node.
+func (r *Result) Table(wide bool) check.Table {
+	t := check.Table{Header: []string{"STATUS", "NODE", "CILIUM-POD", "SNAT-MAP-USAGE", "CURRENT/MAX"}}
+	if wide {
+		t.Header = []string{"STATUS", "NODE", "CILIUM-POD", "MAP", "ID", "TYPE", "KEY/VALUE", "MEMLOCK", "SNAT-MAP-USAGE", "CURRENT/MAX", "ERROR"}
+	}
+	for _, node := range r.Items {
+		status := node.Status.Label()
+		switch {
+		case wide:
+			t.Rows = append(t.Rows, []string{status, node.Node, node.Pod, node.Map,
+				fmt.Sprint(node.ID), node.Type, fmt.Sprintf("%d/%d", node.KeySize, node.ValueSize), output.Bytes(node.Memlock),
+				fmt.Sprintf("%.2f%%", node.Usage), fmt.Sprintf("%d/%d", node.CurrentEntries, node.MaxEntries), node.Error})
+		case node.Status == check.Unknown:
+			t.Rows = append(t.Rows, []string{status, node.Node, node.Pod})
+		default:
+			t.Rows = append(t.Rows, []string{status, node.Node, node.Pod,
+				fmt.Sprintf("%.2f%%", node.Usage), fmt.Sprintf("%d/%d", node.CurrentEntries, node.MaxEntries)})
+		}
+	}
+	return t
+}
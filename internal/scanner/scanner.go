@@ -1,32 +1,28 @@
 package scanner
 
 import (
-	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"sort"
-	"strconv"
-	"strings"
+	"path"
 	"sync"
-	"text/tabwriter"
 	"time"
 
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/remotecommand"
-
-	"github.com/alitto/pond/v2"
+	"github.com/gyutaeb/kubectl-cilium/internal/batch"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/clientcmd"
 )
 
 const (
-	execTimeout  = 10 * time.Second
-	poolSize     = 10
-	warningRatio = 0.8
+	k8sTimeout = 10 * time.Second
+	// countTimeout bounds counting the SNAT map, which is dumped when the
+	// bpf-map-count helper is not installed in the agent image.
+	countTimeout = 1800 * time.Second
+
+	globalsDir = "/sys/fs/bpf/tc/globals"
 )
 
 type NodeInfo struct {
@@ -35,43 +31,39 @@ type NodeInfo struct {
 	MaxCnt     int
 	CurrentCnt int
 	Usage      float64
+	Info       bpftool.MapInfo
+	Status     check.Status
+	Err        string
 }
 
-type nodeGroup struct {
-	mu    sync.Mutex
-	nodes []NodeInfo
+type Options struct {
+	check.Options
 }
 
 type Scanner struct {
-	kc      *kubernetes.Clientset
-	restCfg *rest.Config
+	env  *check.Env
+	opts Options
+	out  io.Writer
+	// progress receives the progress and exec errors of the scans.
+	progress io.Writer
 
-	warningNodes nodeGroup
-	normalNodes  nodeGroup
-	unknownNodes nodeGroup
+	// helperOnce looks up the bpf-map-count helper before the first dump.
+	helperOnce sync.Once
+
+	mu    sync.Mutex
+	nodes []NodeInfo
 }
 
-func NewScanner(kc *kubernetes.Clientset, restCfg *rest.Config, kubeconfig string) (*Scanner, error) {
-	if kc == nil || restCfg == nil {
-		if kubeconfig == "" {
-			kubeconfig = os.ExpandEnv("$HOME/.kube/config")
-		}
-		if kubeconfig == "" {
-			kubeconfig = os.Getenv("KUBECONFIG")
-		}
-		var err error
-		kc, restCfg, err = kubernetesClient(kubeconfig)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
-		}
-	}
+var _ check.Check = (*Scanner)(nil)
+
+func NewScanner(env *check.Env, opts Options) (*Scanner, error) {
+	opts.Options = opts.Options.WithDefaults()
 
 	return &Scanner{
-		kc:           kc,
-		restCfg:      restCfg,
-		warningNodes: nodeGroup{},
-		normalNodes:  nodeGroup{},
-		unknownNodes: nodeGroup{},
+		env:      env,
+		opts:     opts,
+		out:      os.Stdout,
+		progress: os.Stderr,
 	}, nil
 }
 
@@ -79,163 +71,109 @@ func (s *Scanner) Validate() (err error) {
 	return nil
 }
 
-func (s *Scanner) Run(nodename string) error {
-	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+func (s *Scanner) Run(nodes check.NodeFilter) error {
+	_, err := check.Run(context.Background(), s, nodes, s.out, s.opts.Output)
+	return err
+}
+
+// Collect checks the SNAT map in the cilium-agent pods of the selected nodes.
+func (s *Scanner) Collect(ctx context.Context, nodes check.NodeFilter) error {
+	listCtx, cancel := context.WithTimeout(ctx, k8sTimeout)
 	defer cancel()
-	ciliumPods, err := s.kc.CoreV1().Pods("kube-system").List(ctx, metav1.ListOptions{LabelSelector: "k8s-app=cilium"})
+	ciliumPods, err := nodes.AgentPods(listCtx, s.env.Client)
 	if err != nil {
-		return fmt.Errorf("failed to list Cilium pods: %w", err)
+		return err
 	}
-	if nodename != "" {
-		var filteredPods []corev1.Pod
-		for _, pod := range ciliumPods.Items {
-			if pod.Spec.NodeName == nodename {
-				filteredPods = append(filteredPods, pod)
-			}
-		}
-		ciliumPods.Items = filteredPods
+	if len(ciliumPods) == 0 {
+		return fmt.Errorf("no cilium-agent pods found on the selected nodes")
 	}
 
-	pool := pond.NewPool(poolSize)
-	for _, pod := range ciliumPods.Items {
-		pool.Submit(func() {
-			s.processPod(pod)
-		})
-	}
-	pool.StopAndWait()
+	s.mu.Lock()
+	s.nodes = nil
+	s.mu.Unlock()
 
-	err = s.print()
-	if err != nil {
-		return fmt.Errorf("failed to print results: %w", err)
-	}
+	check.ForEach(ctx, s.opts.Concurrency, ciliumPods, func(pod corev1.Pod) {
+		s.processPod(ctx, pod)
+	})
 	return nil
 }
 
-func (s *Scanner) print() error {
-	sort.Slice(s.warningNodes.nodes, func(i, j int) bool {
-		return s.warningNodes.nodes[i].Usage > s.warningNodes.nodes[j].Usage
-	})
-	sort.Slice(s.normalNodes.nodes, func(i, j int) bool {
-		return s.normalNodes.nodes[i].Usage > s.normalNodes.nodes[j].Usage
-	})
+func (s *Scanner) Evaluate() check.Report {
+	return s.Result()
+}
 
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	fmt.Fprintf(w, "\nSTATUS\tNODE\tCILIUM-POD\tSNAT-MAP-USAGE\tCURRENT/MAX\n")
-	for _, node := range s.warningNodes.nodes {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f%%\t%d/%d\n", "[Warning]", node.NodeName, node.PodName, node.Usage, node.CurrentCnt, node.MaxCnt)
-	}
-	for _, node := range s.normalNodes.nodes {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%.2f%%\t%d/%d\n", "[O.K.]", node.NodeName, node.PodName, node.Usage, node.CurrentCnt, node.MaxCnt)
-	}
-	for _, node := range s.unknownNodes.nodes {
-		fmt.Fprintf(w, "%s\t%s\t%s\n", "[Unknown]", node.NodeName, node.PodName)
+func (s *Scanner) processPod(ctx context.Context, pod corev1.Pod) {
+	node := NodeInfo{
+		NodeName: pod.Spec.NodeName,
+		PodName:  pod.Name,
 	}
-
-	err := w.Flush()
+	err := s.inspectPod(ctx, &pod, &node)
 	if err != nil {
-		return fmt.Errorf("failed to flush tab writer: %w", err)
+		node.Status, node.Err = check.Unknown, err.Error()
 	}
-	return nil
+
+	s.mu.Lock()
+	s.nodes = append(s.nodes, node)
+	s.mu.Unlock()
 }
 
-func (s *Scanner) processPod(pod corev1.Pod) (err error) {
-	defer func() {
+func (s *Scanner) inspectPod(ctx context.Context, pod *corev1.Pod, node *NodeInfo) error {
+	fmt.Fprintf(s.progress, "Checking node... %s, cilium pod: %s\n", pod.Spec.NodeName, pod.Name)
+
+	stats, ok := s.env.Maps.Load(pod.Spec.NodeName, snatMap)
+	if !ok {
+		var err error
+		stats, err = s.readSnatMap(ctx, pod)
 		if err != nil {
-			s.unknownNodes.mu.Lock()
-			s.unknownNodes.nodes = append(s.unknownNodes.nodes, NodeInfo{
-				NodeName: pod.Spec.NodeName,
-				PodName:  pod.Name,
-			})
-			s.unknownNodes.mu.Unlock()
+			return err
 		}
-	}()
-	fmt.Printf("Checking node... %s, cilium pod: %s\n", pod.Spec.NodeName, pod.Name)
-
-	cmd := []string{"sh", "-c", "bpftool map show pinned /sys/fs/bpf/tc/globals/cilium_snat_v4_external | grep -o 'max_entries [0-9]\\+' | awk '{print $2}'"}
-	result, err := s.execCmd(&pod, cmd)
-	if err != nil {
-		return err
-	}
-	maxCnt, err := strconv.Atoi(result)
-	if err != nil {
-		return err
-	}
-
-	cmd = []string{"sh", "-c", "bpftool map dump pinned /sys/fs/bpf/tc/globals/cilium_snat_v4_external | grep elements | awk '{print $2}'"}
-	result, err = s.execCmd(&pod, cmd)
-	if err != nil {
-		return err
-	}
-	currentCnt, err := strconv.Atoi(result)
-	if err != nil {
-		return err
-	}
-
-	if currentCnt >= int(float64(maxCnt)*warningRatio) {
-		s.warningNodes.mu.Lock()
-		s.warningNodes.nodes = append(s.warningNodes.nodes, NodeInfo{
-			NodeName:   pod.Spec.NodeName,
-			PodName:    pod.Name,
-			MaxCnt:     maxCnt,
-			CurrentCnt: currentCnt,
-			Usage:      float64(currentCnt) / float64(maxCnt) * 100,
-		})
-		s.warningNodes.mu.Unlock()
-	} else {
-		s.normalNodes.mu.Lock()
-		s.normalNodes.nodes = append(s.normalNodes.nodes, NodeInfo{
-			NodeName:   pod.Spec.NodeName,
-			PodName:    pod.Name,
-			MaxCnt:     maxCnt,
-			CurrentCnt: currentCnt,
-			Usage:      float64(currentCnt) / float64(maxCnt) * 100,
-		})
-		s.normalNodes.mu.Unlock()
 	}
+	maxCnt, currentCnt := stats.Info.MaxEntries, stats.CurrentEntries
 
+	node.MaxCnt = maxCnt
+	node.CurrentCnt = currentCnt
+	node.Usage = float64(currentCnt) / float64(maxCnt) * 100
+	node.Info = stats.Info
+	node.Status = check.StatusOf(s.opts.Thresholds.Classify(snatMap, currentCnt, maxCnt))
 	return nil
 }
 
-func (s *Scanner) execCmd(pod *corev1.Pod, cmd []string) (string, error) {
-	req := s.kc.CoreV1().RESTClient().Post().Namespace("kube-system").Resource("pods").
-		Name(pod.Name).SubResource("exec").VersionedParams(&corev1.PodExecOptions{
-		Container: "cilium-agent",
-		Command:   cmd,
-		Stdout:    true,
-		Stderr:    true,
-	}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(s.restCfg, "POST", req.URL())
+// readSnatMap counts the SNAT map in the cilium-agent pod with a single exec
+// of the batch script, so that only the count is returned when the
+// bpf-map-count helper is installed.
+func (s *Scanner) readSnatMap(ctx context.Context, pod *corev1.Pod) (check.MapStats, error) {
+	s.helperOnce.Do(func() { s.checkCountHelper(ctx, pod) })
+	result, err := s.execCmd(ctx, pod, batch.Cmd(globalsDir, []string{snatMap}))
 	if err != nil {
-		fmt.Printf("[Pre-exec-error] pod:%s, node:%s, err:%v\n", pod.Name, pod.Spec.NodeName, err)
-		return "", err
+		return check.MapStats{}, err
 	}
-
-	var stdout, stderr bytes.Buffer
-	ctx, cancle := context.WithTimeout(context.Background(), execTimeout)
-	defer cancle()
-
-	err = exec.StreamWithContext(ctx, remotecommand.StreamOptions{
-		Stdout: &stdout,
-		Stderr: &stderr,
-	})
-	if err != nil {
-		fmt.Printf("[Exec-error] pod:%s, node:%s, stderr:%s, err:%v\n", pod.Name, pod.Spec.NodeName, stderr.String(), err)
-		return "", err
+	stats := batch.Parse(result)
+	if len(stats) == 0 {
+		return check.MapStats{}, fmt.Errorf("map %s is not pinned", path.Join(globalsDir, snatMap))
 	}
-
-	return strings.TrimSpace(stdout.String()), nil
+	if stats[0].Err != nil {
+		return check.MapStats{}, stats[0].Err
+	}
+	return check.MapStats{Info: *stats[0].Info, CurrentEntries: stats[0].Entries}, nil
 }
 
-func kubernetesClient(kubeConfig string) (*kubernetes.Clientset, *rest.Config, error) {
-	config, err := clientcmd.BuildConfigFromFlags("", kubeConfig)
-	if err != nil {
-		return nil, nil, err
+// checkCountHelper warns when the bpf-map-count helper is not installed in
+// the cilium-agent containers, as the SNAT map is then dumped. All agents run
+// the same image, so only the first one is checked.
+func (s *Scanner) checkCountHelper(ctx context.Context, pod *corev1.Pod) {
+	_, err := s.env.Exec(ctx, pod, check.AgentContainer, bpfcount.LookupCmd, k8sTimeout)
+	if err == nil || ctx.Err() != nil {
+		return
 	}
+	fmt.Fprintf(s.progress, "\033[33mWarning: %s is not installed in the cilium-agent containers, so the SNAT map is counted with a full bpftool map dump, which is slow and memory-hungry on large maps.\033[0m\n", bpfcount.HelperName)
+}
 
-	kc, err := kubernetes.NewForConfig(config)
+func (s *Scanner) execCmd(ctx context.Context, pod *corev1.Pod, cmd []string) (string, error) {
+	result, err := s.env.Exec(ctx, pod, check.AgentContainer, cmd, countTimeout)
 	if err != nil {
-		return nil, nil, err
+		fmt.Fprintf(s.progress, "[Exec-error] pod:%s, node:%s, err:%v\n", pod.Name, pod.Spec.NodeName, err)
+		return "", err
 	}
-	return kc, config, nil
+
+	return result, nil
 }
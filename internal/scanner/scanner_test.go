@@ -0,0 +1,245 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/batch"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/executor/fake"
+	"github.com/gyutaeb/kubectl-cilium/internal/output"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeNode struct {
+	show string
+	dump string
+	// helper counts the map with the bpf-map-count helper instead of a dump.
+	helper bool
+	err    error
+}
+
+func snatNode(maxEntries, currentEntries int) fakeNode {
+	items := make([]string, currentEntries)
+	for i := range items {
+		items[i] = `{"key":["0x00"],"value":["0x00"]}`
+	}
+	return fakeNode{
+		show: fmt.Sprintf(`{"id":3,"type":"lru_hash","name":"cilium_snat_v4_","flags":0,"bytes_key":14,"bytes_value":40,"max_entries":%d,"bytes_memlock":8192}`, maxEntries),
+		dump: "[" + strings.Join(items, ",") + "]",
+	}
+}
+
+func newTestScanner(t *testing.T, nodes map[string]fakeNode) (*Scanner, *fake.Executor, *bytes.Buffer) {
+	t.Helper()
+
+	var objects []runtime.Object
+	for nodeName := range nodes {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cilium-" + nodeName,
+				Namespace: "kube-system",
+				Labels:    map[string]string{"k8s-app": "cilium"},
+			},
+			Spec: corev1.PodSpec{NodeName: nodeName},
+		})
+	}
+	objects = append(objects, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "coredns",
+			Namespace: "kube-system",
+			Labels:    map[string]string{"k8s-app": "kube-dns"},
+		},
+	})
+
+	exec := &fake.Executor{
+		Handler: func(pod *corev1.Pod, container string, cmd []string) (string, error) {
+			if container != "cilium-agent" {
+				t.Errorf("unexpected container %q", container)
+			}
+			node := nodes[pod.Spec.NodeName]
+			if node.err != nil {
+				return "", node.err
+			}
+			if slices.Equal(cmd, bpfcount.LookupCmd) {
+				if !node.helper {
+					return "", fake.ExitError(1)
+				}
+				return "/usr/local/bin/" + bpfcount.HelperName, nil
+			}
+			if !slices.Equal(cmd, batch.Cmd(globalsDir, []string{snatMap})) {
+				return "", errors.New("unexpected command")
+			}
+			if node.show == "" {
+				return "", nil
+			}
+			method, count := batch.MethodDump, node.dump
+			if node.helper {
+				method = batch.MethodHelper
+			}
+			return fmt.Sprintf(`{"map":%q,"method":%q,"show":%s,"count":%s}`+"\n", snatMap, method, node.show, count), nil
+		},
+	}
+
+	env := &check.Env{Client: k8sfake.NewClientset(objects...), Executor: exec}
+	s, err := NewScanner(env, Options{Options: check.Options{Output: output.JSON}})
+	if err != nil {
+		t.Fatalf("NewScanner: %v", err)
+	}
+	out := &bytes.Buffer{}
+	s.out = out
+	s.progress = io.Discard
+	return s, exec, out
+}
+
+func TestRunClassifiesNodes(t *testing.T) {
+	s, _, out := newTestScanner(t, map[string]fakeNode{
+		"node-1": snatNode(1000, 800),
+		"node-2": snatNode(1000, 799),
+		"node-3": snatNode(1000, 10),
+		"node-4": snatNode(1000, 950),
+	})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	result := s.Result()
+	want := []struct {
+		node   string
+		status check.Status
+	}{
+		{"node-4", "Critical"},
+		{"node-1", "Warning"},
+		{"node-2", "OK"},
+		{"node-3", "OK"},
+	}
+	if len(result.Items) != len(want) {
+		t.Fatalf("expected %d items, got %+v", len(want), result.Items)
+	}
+	for i, w := range want {
+		item := result.Items[i]
+		if item.Node != w.node || item.Status != w.status {
+			t.Errorf("item %d: expected %s %s, got %s %s", i, w.node, w.status, item.Node, item.Status)
+		}
+	}
+	if result.Items[0].Usage != 95 || result.Items[0].CurrentEntries != 950 || result.Items[0].MaxEntries != 1000 || result.Items[0].Type != "lru_hash" {
+		t.Errorf("unexpected stats: %+v", result.Items[0])
+	}
+	if !strings.Contains(out.String(), `"kind": "SNATEvictionResult"`) {
+		t.Errorf("expected JSON output, got %s", out.String())
+	}
+}
+
+func TestRunUnknownNodes(t *testing.T) {
+	s, _, _ := newTestScanner(t, map[string]fakeNode{
+		"node-1": {err: fake.ExitError(1)},
+		"node-2": {show: `{"error":"bpf obj get (/sys/fs/bpf/tc/globals): No such file or directory"}`, dump: "[]"},
+		"node-3": snatNode(1000, 1),
+		"node-4": {},
+	})
+	progress := &bytes.Buffer{}
+	s.progress = progress
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if !strings.Contains(progress.String(), "[Exec-error] pod:cilium-node-1") {
+		t.Errorf("expected the exec error in the progress, got %q", progress.String())
+	}
+
+	result := s.Result()
+	unknown := map[string]string{}
+	for _, item := range result.Items {
+		if item.Status == "Unknown" {
+			unknown[item.Node] = item.Error
+		}
+	}
+	if len(unknown) != 3 {
+		t.Fatalf("expected 3 unknown nodes, got %+v", result.Items)
+	}
+	for node, msg := range unknown {
+		if msg == "" {
+			t.Errorf("expected an error message for %s", node)
+		}
+	}
+	if result.Items[0].Node != "node-3" {
+		t.Errorf("expected known nodes to be listed first, got %+v", result.Items)
+	}
+}
+
+func TestRunTargetNode(t *testing.T) {
+	s, exec, _ := newTestScanner(t, map[string]fakeNode{
+		"node-1": snatNode(1000, 1),
+		"node-2": snatNode(1000, 1),
+	})
+
+	if err := s.Run(check.NodeFilter{Names: []string{"node-2"}}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	for _, call := range exec.Calls() {
+		if call.Pod != "cilium-node-2" {
+			t.Errorf("unexpected exec into %s", call.Pod)
+		}
+	}
+	result := s.Result()
+	if len(result.Items) != 1 || result.Items[0].Node != "node-2" {
+		t.Errorf("expected only node-2, got %+v", result.Items)
+	}
+
+	if err := s.Run(check.NodeFilter{Names: []string{"node-3"}}); err == nil {
+		t.Error("expected an error when no cilium-agent pod is selected")
+	}
+}
+
+func TestRunReusesSharedMaps(t *testing.T) {
+	s, exec, _ := newTestScanner(t, map[string]fakeNode{
+		"node-1": snatNode(1000, 1),
+		"node-2": snatNode(1000, 1),
+	})
+	s.env.Maps = check.NewMapCache()
+	s.env.Maps.Store("node-1", snatMap, check.MapStats{Info: bpftool.MapInfo{Type: "lru_hash", MaxEntries: 1000}, CurrentEntries: 900})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	for _, call := range exec.Calls() {
+		if call.Pod == "cilium-node-1" {
+			t.Errorf("unexpected exec into %s, its SNAT map was shared", call.Pod)
+		}
+	}
+	result := s.Result()
+	if len(result.Items) != 2 || result.Items[0].Node != "node-1" || result.Items[0].Status != check.Critical || result.Items[0].CurrentEntries != 900 {
+		t.Errorf("expected node-1 to be Critical from the shared map, got %+v", result.Items)
+	}
+}
+
+func TestRunCountsInAgent(t *testing.T) {
+	node := snatNode(1000, 0)
+	node.dump, node.helper = `{"entries":850,"max_entries":1000}`, true
+	s, exec, _ := newTestScanner(t, map[string]fakeNode{"node-1": node})
+
+	if err := s.Run(check.NodeFilter{}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	if calls := exec.Calls(); len(calls) != 2 || !slices.Equal(calls[0].Cmd, bpfcount.LookupCmd) {
+		t.Errorf("expected the helper lookup and a single count, got %+v", calls)
+	}
+	result := s.Result()
+	if len(result.Items) != 1 || result.Items[0].CurrentEntries != 850 || result.Items[0].Status != check.Warning {
+		t.Errorf("expected 850 entries counted by the helper, got %+v", result.Items)
+	}
+}
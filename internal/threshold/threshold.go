@@ -0,0 +1,157 @@
+package threshold
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	DefaultWarning  = 0.8
+	DefaultCritical = 0.9
+)
+
+type Level string
+
+const (
+	OK       Level = "OK"
+	Warning  Level = "Warning"
+	Critical Level = "Critical"
+)
+
+// Ratios are usage ratios (0, 1] at which a map is reported as Warning or Critical.
+// A zero value means "inherit from the enclosing configuration".
+type Ratios struct {
+	Warning  float64 `json:"warning,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+}
+
+// Config holds the global thresholds and per-map overrides. Map keys are map
+// names or shell patterns such as "cilium_ct*". An exact name wins over a
+// pattern, and a longer pattern wins over a shorter one.
+//
+// Example file:
+//
+//	warning: 0.8
+//	critical: 0.9
+//	maps:
+//	  cilium_ct*:
+//	    warning: 0.7
+//	  cilium_nodeport_neigh*:
+//	    warning: 0.9
+//	    critical: 0.95
+type Config struct {
+	Ratios `json:",inline"`
+	Maps   map[string]Ratios `json:"maps,omitempty"`
+}
+
+func Default() *Config {
+	return &Config{
+		Ratios: Ratios{
+			Warning:  DefaultWarning,
+			Critical: DefaultCritical,
+		},
+	}
+}
+
+// LoadFile reads a YAML or JSON threshold file. Unset global thresholds keep their defaults.
+func LoadFile(filename string) (*Config, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read threshold file: %w", err)
+	}
+
+	c := Default()
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("failed to parse threshold file %s: %w", filename, err)
+	}
+	return c, c.Validate()
+}
+
+func (c *Config) Validate() error {
+	if err := c.Ratios.validate("global"); err != nil {
+		return err
+	}
+	for pattern := range c.Maps {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid map pattern %q: %w", pattern, err)
+		}
+		if err := c.For(pattern).validate(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Ratios) validate(scope string) error {
+	if r.Warning <= 0 || r.Warning > 1 {
+		return fmt.Errorf("%s warning threshold %v must be in (0, 1]", scope, r.Warning)
+	}
+	if r.Critical <= 0 || r.Critical > 1 {
+		return fmt.Errorf("%s critical threshold %v must be in (0, 1]", scope, r.Critical)
+	}
+	if r.Critical < r.Warning {
+		return fmt.Errorf("%s critical threshold %v must not be lower than warning threshold %v", scope, r.Critical, r.Warning)
+	}
+	return nil
+}
+
+// For returns the effective thresholds of a map.
+func (c *Config) For(mapName string) Ratios {
+	r := c.Ratios
+
+	override, ok := c.Maps[mapName]
+	if !ok {
+		patterns := make([]string, 0, len(c.Maps))
+		for pattern := range c.Maps {
+			patterns = append(patterns, pattern)
+		}
+		sort.Slice(patterns, func(i, j int) bool {
+			if len(patterns[i]) != len(patterns[j]) {
+				return len(patterns[i]) > len(patterns[j])
+			}
+			return patterns[i] < patterns[j]
+		})
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, mapName); matched {
+				override, ok = c.Maps[pattern], true
+				break
+			}
+		}
+	}
+	if ok {
+		if override.Warning > 0 {
+			r.Warning = override.Warning
+		}
+		if override.Critical > 0 {
+			r.Critical = override.Critical
+		}
+	}
+	return r
+}
+
+// Classify returns the level of a map holding current out of max entries.
+// A map without a size is OK, as its usage is unknown.
+func (c *Config) Classify(mapName string, current, max int) Level {
+	if max <= 0 {
+		return OK
+	}
+	return c.ClassifyRatio(mapName, float64(current)/float64(max))
+}
+
+// ClassifyRatio returns the level of a map filled to ratio of its size, for
+// sources that report the usage but not the entries.
+func (c *Config) ClassifyRatio(mapName string, ratio float64) Level {
+	r := c.For(mapName)
+	switch {
+	case ratio >= r.Critical:
+		return Critical
+	case ratio >= r.Warning:
+		return Warning
+	default:
+		return OK
+	}
+}
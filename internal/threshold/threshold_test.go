@@ -0,0 +1,120 @@
+package threshold
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	c := &Config{
+		Ratios: Ratios{Warning: 0.8, Critical: 0.9},
+		Maps: map[string]Ratios{
+			"cilium_ct*":             {Warning: 0.7},
+			"cilium_ct_any*":         {Warning: 0.5, Critical: 0.6},
+			"cilium_nodeport_neigh4": {Warning: 0.9, Critical: 0.95},
+		},
+	}
+
+	tests := []struct {
+		mapName string
+		current int
+		level   Level
+	}{
+		{"cilium_snat_v4_external", 799, OK},
+		{"cilium_snat_v4_external", 800, Warning},
+		{"cilium_snat_v4_external", 900, Critical},
+		{"cilium_ct4_global", 699, OK},
+		{"cilium_ct4_global", 700, Warning},
+		{"cilium_ct4_global", 900, Critical},
+		{"cilium_ct_any4_global", 500, Warning},
+		{"cilium_ct_any4_global", 600, Critical},
+		{"cilium_nodeport_neigh4", 899, OK},
+		{"cilium_nodeport_neigh4", 900, Warning},
+		{"cilium_nodeport_neigh4", 950, Critical},
+		{"cilium_nodeport_neigh6", 800, Warning},
+	}
+	for _, tt := range tests {
+		if level := c.Classify(tt.mapName, tt.current, 1000); level != tt.level {
+			t.Errorf("%s %d/1000: expected %s, got %s", tt.mapName, tt.current, tt.level, level)
+		}
+	}
+
+	small := []struct {
+		current, max int
+		level        Level
+	}{
+		{0, 1, OK},
+		{1, 1, Critical},
+		{0, 4, OK},
+		{3, 4, OK},
+		{1, 10, OK},
+		{0, 0, OK},
+	}
+	for _, tt := range small {
+		if level := c.Classify("cilium_snat_v4_external", tt.current, tt.max); level != tt.level {
+			t.Errorf("%d/%d: expected %s, got %s", tt.current, tt.max, tt.level, level)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "thresholds.yaml")
+	err := os.WriteFile(filename, []byte(`
+critical: 0.95
+maps:
+  cilium_ct*:
+    warning: 0.7
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadFile(filename)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if c.Warning != DefaultWarning || c.Critical != 0.95 {
+		t.Errorf("unexpected global thresholds %+v", c.Ratios)
+	}
+	if r := c.For("cilium_ct4_global"); r.Warning != 0.7 || r.Critical != 0.95 {
+		t.Errorf("unexpected ct thresholds %+v", r)
+	}
+}
+
+func TestLoadFileInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":        "warn: 0.7\n",
+		"out of range":         "warning: 80\n",
+		"critical below warn":  "warning: 0.9\ncritical: 0.8\n",
+		"map critical too low": "maps:\n  cilium_ct*:\n    critical: 0.5\n",
+		"bad pattern":          "maps:\n  \"cilium_[\":\n    warning: 0.5\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "thresholds.yaml")
+			if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadFile(filename); err == nil {
+				t.Errorf("expected an error for %q", content)
+			}
+		})
+	}
+}
+
+func TestClassifyRatio(t *testing.T) {
+	c := &Config{
+		Ratios: Ratios{Warning: 0.8, Critical: 0.9},
+		Maps:   map[string]Ratios{"cilium_ct*": {Warning: 0.7}},
+	}
+	if level := c.ClassifyRatio("cilium_snat_v4_external", 0.79); level != OK {
+		t.Errorf("expected OK, got %v", level)
+	}
+	if level := c.ClassifyRatio("cilium_ct4_global", 0.75); level != Warning {
+		t.Errorf("expected Warning, got %v", level)
+	}
+	if level := c.ClassifyRatio("cilium_ct4_global", 1.2); level != Critical {
+		t.Errorf("expected Critical, got %v", level)
+	}
+}
@@ -0,0 +1,455 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfmaps"
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/check"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+type view int
+
+const (
+	nodesView view = iota
+	mapsView
+	entriesView
+)
+
+type filterKind int
+
+const (
+	noFilter filterKind = iota
+	mapFilter
+	labelFilter
+)
+
+// action is the I/O the model asks Run to perform after a key press.
+type action int
+
+const (
+	actionNone action = iota
+	actionRescan
+	actionSample
+	actionQuit
+)
+
+type key string
+
+const (
+	keyUp        key = "up"
+	keyDown      key = "down"
+	keyLeft      key = "left"
+	keyRight     key = "right"
+	keyEnter     key = "enter"
+	keyEsc       key = "esc"
+	keyBackspace key = "backspace"
+	keyCtrlC     key = "ctrl-c"
+)
+
+// statusSeverity orders the statuses from the least to the most severe.
+var statusSeverity = map[check.Status]int{
+	check.OK:       0,
+	check.Unknown:  1,
+	check.Warning:  2,
+	check.Critical: 3,
+}
+
+type nodeRow struct {
+	name   string
+	status check.Status
+	worst  float64
+	maps   int
+}
+
+// model is the state of the terminal UI. It does no I/O, Run feeds it keys
+// and performs the actions it returns.
+type model struct {
+	result *pressure.Result
+	labels map[string]map[string]string
+
+	view    view
+	cursor  [3]int
+	node    string
+	mapName string
+
+	entries   []bpftool.Entry
+	sampleErr error
+
+	mapFilter    string
+	selector     labels.Selector
+	selectorText string
+
+	editing filterKind
+	input   string
+	message string
+}
+
+func newModel() *model {
+	return &model{
+		result:   &pressure.Result{},
+		selector: labels.Everything(),
+	}
+}
+
+func (m *model) load(result *pressure.Result, nodeLabels map[string]map[string]string) {
+	m.result = result
+	m.labels = nodeLabels
+	m.message = ""
+	m.clampCursor()
+}
+
+func (m *model) setSample(entries []bpftool.Entry, err error) {
+	m.entries = entries
+	m.sampleErr = err
+	m.cursor[entriesView] = 0
+}
+
+// nodeRows lists the nodes matching the label selector, sorted by the usage of
+// their worst map. Only maps matching the map filter are taken into account.
+func (m *model) nodeRows() []nodeRow {
+	rows := map[string]*nodeRow{}
+	for _, item := range m.result.Items {
+		if !m.selector.Matches(labels.Set(m.labels[item.Node])) || !m.matchMap(item.Map) {
+			continue
+		}
+		row, ok := rows[item.Node]
+		if !ok {
+			row = &nodeRow{name: item.Node, status: item.Status}
+			rows[item.Node] = row
+		}
+		row.maps++
+		row.worst = max(row.worst, item.Usage)
+		if statusSeverity[item.Status] > statusSeverity[row.status] {
+			row.status = item.Status
+		}
+	}
+
+	sorted := make([]nodeRow, 0, len(rows))
+	for _, row := range rows {
+		sorted = append(sorted, *row)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].worst != sorted[j].worst {
+			return sorted[i].worst > sorted[j].worst
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	return sorted
+}
+
+// mapRows lists the maps of the selected node matching the map filter, sorted by usage.
+func (m *model) mapRows() []pressure.MapResult {
+	var rows []pressure.MapResult
+	for _, item := range m.result.Items {
+		if item.Node == m.node && m.matchMap(item.Map) {
+			rows = append(rows, item)
+		}
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Usage != rows[j].Usage {
+			return rows[i].Usage > rows[j].Usage
+		}
+		return rows[i].Map < rows[j].Map
+	})
+	return rows
+}
+
+func (m *model) selectedMap() (pressure.MapResult, bool) {
+	for _, item := range m.result.Items {
+		if item.Node == m.node && item.Map == m.mapName {
+			return item, true
+		}
+	}
+	return pressure.MapResult{}, false
+}
+
+func (m *model) matchMap(name string) bool {
+	return strings.Contains(name, m.mapFilter)
+}
+
+func (m *model) rowCount() int {
+	switch m.view {
+	case mapsView:
+		return len(m.mapRows())
+	case entriesView:
+		return len(m.entries)
+	default:
+		return len(m.nodeRows())
+	}
+}
+
+func (m *model) clampCursor() {
+	last := m.rowCount() - 1
+	m.cursor[m.view] = max(0, min(m.cursor[m.view], last))
+}
+
+func (m *model) update(k key) action {
+	if k == keyCtrlC {
+		return actionQuit
+	}
+	if m.editing != noFilter {
+		m.edit(k)
+		return actionNone
+	}
+
+	m.message = ""
+	switch k {
+	case keyUp, "k":
+		m.cursor[m.view]--
+	case keyDown, "j":
+		m.cursor[m.view]++
+	case keyEnter, keyRight, "l":
+		return m.open()
+	case keyEsc, keyLeft, keyBackspace, "h":
+		if m.view > nodesView {
+			m.view--
+		}
+	case "/":
+		m.editing, m.input = mapFilter, m.mapFilter
+	case "f":
+		m.editing, m.input = labelFilter, m.selectorText
+	case "r":
+		return actionRescan
+	case "q":
+		return actionQuit
+	}
+	m.clampCursor()
+	return actionNone
+}
+
+func (m *model) open() action {
+	switch m.view {
+	case nodesView:
+		rows := m.nodeRows()
+		if len(rows) == 0 {
+			return actionNone
+		}
+		m.node = rows[m.cursor[nodesView]].name
+		m.view = mapsView
+		m.cursor[mapsView] = 0
+	case mapsView:
+		rows := m.mapRows()
+		if len(rows) == 0 {
+			return actionNone
+		}
+		m.mapName = rows[m.cursor[mapsView]].Map
+		m.view = entriesView
+		m.setSample(nil, nil)
+		return actionSample
+	}
+	return actionNone
+}
+
+func (m *model) edit(k key) {
+	switch k {
+	case keyEnter:
+		m.applyFilter()
+	case keyEsc:
+		m.editing = noFilter
+	case keyBackspace:
+		if r := []rune(m.input); len(r) > 0 {
+			m.input = string(r[:len(r)-1])
+		}
+	default:
+		if len([]rune(string(k))) == 1 {
+			m.input += string(k)
+		}
+	}
+}
+
+func (m *model) applyFilter() {
+	switch m.editing {
+	case mapFilter:
+		m.mapFilter = m.input
+	case labelFilter:
+		selector, err := labels.Parse(m.input)
+		if err != nil {
+			m.message = fmt.Sprintf("invalid label selector: %v", err)
+			return
+		}
+		m.selector, m.selectorText = selector, m.input
+	}
+	m.editing = noFilter
+	m.clampCursor()
+}
+
+// render draws the current view into width x height cells.
+func (m *model) render(width, height int) string {
+	var title string
+	var header []string
+	var rows []string
+
+	switch m.view {
+	case nodesView:
+		title = "Nodes"
+		for _, row := range m.nodeRows() {
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%.2f%%\t%d", row.name, row.status, row.worst, row.maps))
+		}
+		rows = table("NODE\tSTATUS\tWORST-USAGE\tMAPS", rows)
+	case mapsView:
+		title = "Node " + m.node
+		for _, item := range m.mapRows() {
+			if item.Status == check.Unknown {
+				rows = append(rows, fmt.Sprintf("%s\t%s\tERR:%s\t", item.Map, item.Status, item.Error))
+				continue
+			}
+			rows = append(rows, fmt.Sprintf("%s\t%s\t%.2f%%\t%s", item.Map, item.Status, item.Usage, item.EntriesLabel()))
+		}
+		rows = table("MAP\tSTATUS\tUSAGE\tCURRENT/MAX", rows)
+	case entriesView:
+		title = "Map " + m.node + "/" + m.mapName
+		header = m.mapHeader()
+		for _, entry := range m.entries {
+			rows = append(rows, bpftool.FormatValue(entry.Key)+"\t"+bpftool.FormatValue(entry.Value))
+		}
+		rows = table("KEY\tVALUE", rows)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "kubectl cilium tui - %s", title)
+	if m.selectorText != "" {
+		fmt.Fprintf(&b, "  [labels: %s]", m.selectorText)
+	}
+	if m.mapFilter != "" {
+		fmt.Fprintf(&b, "  [map: %s]", m.mapFilter)
+	}
+	b.WriteString("\n")
+	for _, line := range header {
+		b.WriteString(truncate(line, width) + "\n")
+	}
+
+	// Title, header lines, column header, blank line and footer.
+	visible := max(1, height-len(header)-4)
+	cursor := m.cursor[m.view]
+	offset := max(0, cursor-visible+1)
+
+	b.WriteString("\n")
+	if len(rows) > 0 {
+		b.WriteString(truncate(rows[0], width) + "\n")
+		rows = rows[1:]
+	}
+	for i := offset; i < len(rows) && i < offset+visible; i++ {
+		line := truncate(rows[i], width)
+		if i == cursor {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		b.WriteString(line + "\n")
+	}
+
+	b.WriteString("\n" + m.footer())
+	return b.String()
+}
+
+func (m *model) mapHeader() []string {
+	item, ok := m.selectedMap()
+	if !ok {
+		return []string{"The map is gone since the last scan."}
+	}
+
+	var header []string
+	if entry, ok := bpfmaps.Lookup(item.Map); ok {
+		header = append(header, entry.Description+lruNote(entry.LRU))
+	}
+	if item.MaxEntries == 0 {
+		header = append(header, fmt.Sprintf("%.2f%% full via %s  %s", item.Usage, item.CountMethod, item.Status))
+	} else {
+		header = append(header, fmt.Sprintf("%s  id %d  key %dB  value %dB  %d/%d entries (%.2f%%)  %s",
+			item.Type, item.ID, item.KeySize, item.ValueSize, item.CurrentEntries, item.MaxEntries, item.Usage, item.Status))
+	}
+	if item.Sizing != nil && item.Sizing.Hint != "" {
+		header = append(header, "Sizing: "+item.Sizing.Hint)
+	}
+	switch {
+	case m.sampleErr != nil:
+		header = append(header, "Failed to sample entries: "+m.sampleErr.Error())
+	case m.entries == nil:
+		header = append(header, "Sampling entries...")
+	default:
+		header = append(header, fmt.Sprintf("Showing the first %d entries.", len(m.entries)))
+	}
+	return header
+}
+
+func lruNote(lru bool) string {
+	if lru {
+		return ", evicts the least recently used entries when full"
+	}
+	return ", fails to insert new entries when full"
+}
+
+func (m *model) footer() string {
+	switch {
+	case m.editing == mapFilter:
+		return "Map name filter: " + m.input + "_"
+	case m.editing == labelFilter:
+		return "Node label selector: " + m.input + "_"
+	case m.message != "":
+		return m.message
+	default:
+		return "up/down move  enter open  esc back  / map filter  f label filter  r rescan  q quit"
+	}
+}
+
+// table aligns tab separated rows below a column header.
+func table(columns string, rows []string) []string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, columns)
+	for _, row := range rows {
+		fmt.Fprintln(w, row)
+	}
+	w.Flush()
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func truncate(line string, width int) string {
+	r := []rune(line)
+	if width <= 0 || len(r) <= width {
+		return line
+	}
+	return string(r[:width])
+}
+
+// parseKeys splits the bytes read from a raw terminal into keys.
+func parseKeys(b []byte) []key {
+	sequences := map[string]key{
+		"\x1b[A": keyUp,
+		"\x1b[B": keyDown,
+		"\x1b[C": keyRight,
+		"\x1b[D": keyLeft,
+	}
+
+	var keys []key
+	for s := string(b); s != ""; {
+		if len(s) >= 3 {
+			if k, ok := sequences[s[:3]]; ok {
+				keys = append(keys, k)
+				s = s[3:]
+				continue
+			}
+		}
+
+		r := []rune(s)[0]
+		switch r {
+		case '\x1b':
+			keys = append(keys, keyEsc)
+		case '\r', '\n':
+			keys = append(keys, keyEnter)
+		case '\x7f', '\b':
+			keys = append(keys, keyBackspace)
+		case '\x03':
+			keys = append(keys, keyCtrlC)
+		default:
+			keys = append(keys, key(string(r)))
+		}
+		s = s[len(string(r)):]
+	}
+	return keys
+}
@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+)
+
+func testModel() *model {
+	m := newModel()
+	m.load(&pressure.Result{Items: []pressure.MapResult{
+		{Node: "node-1", Map: "cilium_ct4_global", Usage: 40, CurrentEntries: 400, MaxEntries: 1000, Status: "OK"},
+		{Node: "node-1", Map: "cilium_snat_v4_external", Usage: 85, CurrentEntries: 850, MaxEntries: 1000, Status: "Warning"},
+		{Node: "node-2", Map: "cilium_ct4_global", Usage: 95, CurrentEntries: 950, MaxEntries: 1000, Status: "Critical"},
+		{Node: "node-3", Map: "cilium_ct4_global", Status: "Unknown", Error: "exec failed"},
+	}}, map[string]map[string]string{
+		"node-1": {"zone": "a"},
+		"node-2": {"zone": "b"},
+		"node-3": {"zone": "a"},
+	})
+	return m
+}
+
+func nodeNames(rows []nodeRow) []string {
+	var names []string
+	for _, row := range rows {
+		names = append(names, row.name)
+	}
+	return names
+}
+
+func typeKeys(m *model, s string) {
+	for _, k := range parseKeys([]byte(s)) {
+		m.update(k)
+	}
+}
+
+func TestNodeRows(t *testing.T) {
+	m := testModel()
+
+	rows := m.nodeRows()
+	if got := nodeNames(rows); !slices.Equal(got, []string{"node-2", "node-1", "node-3"}) {
+		t.Errorf("expected nodes sorted by worst usage, got %v", got)
+	}
+	if rows[1].status != "Warning" || rows[1].worst != 85 || rows[1].maps != 2 {
+		t.Errorf("unexpected node-1 row %+v", rows[1])
+	}
+
+	typeKeys(m, "fzone=a\r")
+	if got := nodeNames(m.nodeRows()); !slices.Equal(got, []string{"node-1", "node-3"}) {
+		t.Errorf("expected nodes in zone a, got %v", got)
+	}
+
+	typeKeys(m, "/snat\r")
+	if got := nodeNames(m.nodeRows()); !slices.Equal(got, []string{"node-1"}) {
+		t.Errorf("expected only nodes with a snat map, got %v", got)
+	}
+
+	typeKeys(m, "fzone in (\r")
+	if m.selectorText != "zone=a" || !strings.Contains(m.message, "invalid label selector") {
+		t.Errorf("expected an invalid selector to be rejected, got %q: %s", m.selectorText, m.message)
+	}
+}
+
+func TestDrillDown(t *testing.T) {
+	m := testModel()
+
+	typeKeys(m, "j")
+	if a := m.update(keyEnter); a != actionNone || m.view != mapsView || m.node != "node-1" {
+		t.Fatalf("expected the maps of node-1, got view %d node %s", m.view, m.node)
+	}
+	if rows := m.mapRows(); rows[0].Map != "cilium_snat_v4_external" {
+		t.Errorf("expected maps sorted by usage, got %+v", rows)
+	}
+
+	if a := m.update(keyEnter); a != actionSample || m.view != entriesView || m.mapName != "cilium_snat_v4_external" {
+		t.Fatalf("expected to sample the snat map, got action %d view %d map %s", a, m.view, m.mapName)
+	}
+	if !strings.Contains(m.render(80, 24), "Sampling entries...") {
+		t.Errorf("expected a sampling message")
+	}
+
+	m.setSample([]bpftool.Entry{{Key: []byte(`["0x0a","0x0b"]`), Value: []byte(`{"packets":3}`)}}, nil)
+	out := m.render(80, 24)
+	for _, want := range []string{"Map node-1/cilium_snat_v4_external", "850/1000 entries", "0a 0b", `{"packets":3}`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in %s", want, out)
+		}
+	}
+
+	m.setSample(nil, errors.New("exec failed"))
+	if !strings.Contains(m.render(80, 24), "Failed to sample entries: exec failed") {
+		t.Errorf("expected the sampling error")
+	}
+
+	typeKeys(m, "\x1b\x1b")
+	if m.view != nodesView || m.cursor[nodesView] != 1 {
+		t.Errorf("expected to go back to the node list at the same row, got view %d cursor %d", m.view, m.cursor[nodesView])
+	}
+}
+
+func TestCursorStaysInRange(t *testing.T) {
+	m := testModel()
+	typeKeys(m, "kkk")
+	if m.cursor[nodesView] != 0 {
+		t.Errorf("expected the cursor at the first row, got %d", m.cursor[nodesView])
+	}
+	typeKeys(m, "jjjjjj")
+	if m.cursor[nodesView] != 2 {
+		t.Errorf("expected the cursor at the last row, got %d", m.cursor[nodesView])
+	}
+	typeKeys(m, "/ct4\rfzone=a\r")
+	if m.cursor[nodesView] != 1 {
+		t.Errorf("expected the cursor clamped to the filtered rows, got %d", m.cursor[nodesView])
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("\x1b[Aj\x1b[B\r\x1b\x7fq\x03é"))
+	want := []key{keyUp, "j", keyDown, keyEnter, keyEsc, keyBackspace, "q", keyCtrlC, "é"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,105 @@
+// Package tui browses the BPF map pressure of the nodes in the terminal. It
+// lists the nodes by their worst map usage and drills into the maps of a node
+// and the entries of a map.
+package tui
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpftool"
+	"github.com/gyutaeb/kubectl-cilium/internal/pressure"
+	"golang.org/x/term"
+)
+
+// sampleLimit is the number of entries shown for a map.
+const sampleLimit = 100
+
+// Source provides the data of the UI. It is implemented by *pressure.Session.
+type Source interface {
+	Scan() *pressure.Result
+	NodeLabels() map[string]map[string]string
+	Sample(nodeName, mapName string, limit int) ([]bpftool.Entry, error)
+	Done() <-chan struct{}
+	// SetProgress redirects the progress messages of the scans.
+	SetProgress(w io.Writer)
+}
+
+// Run scans the nodes and shows the result until the user quits or the
+// source is interrupted. in must be a terminal.
+func Run(src Source, in *os.File, out io.Writer) error {
+	m := newModel()
+	m.load(src.Scan(), src.NodeLabels())
+
+	fd := int(in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to put the terminal into raw mode: %w", err)
+	}
+	defer term.Restore(fd, state)
+
+	/* Switch to the alternate screen and hide the cursor */
+	fmt.Fprint(out, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(out, "\033[?25h\033[?1049l")
+
+	/* Progress messages of the re-scans would be drawn over the screen */
+	src.SetProgress(io.Discard)
+	defer src.SetProgress(os.Stderr)
+
+	/* Stops the key reader once the UI quits, after its pending read */
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := make(chan []byte)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case keys <- append([]byte(nil), buf[:n]...):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	draw := func() {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		fmt.Fprint(out, "\033[H\033[2J"+strings.ReplaceAll(m.render(width, height), "\n", "\r\n"))
+	}
+
+	for {
+		draw()
+		select {
+		case <-src.Done():
+			return nil
+		case b, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range parseKeys(b) {
+				switch m.update(k) {
+				case actionQuit:
+					return nil
+				case actionRescan:
+					m.message = "Scanning..."
+					draw()
+					m.load(src.Scan(), src.NodeLabels())
+				case actionSample:
+					draw()
+					m.setSample(src.Sample(m.node, m.mapName, sampleLimit))
+				}
+			}
+		}
+	}
+}
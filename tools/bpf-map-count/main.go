@@ -0,0 +1,35 @@
+// bpf-map-count prints the number of entries of pinned BPF maps.
+//
+// It is meant to be installed in the inspector image next to bpftool, so that
+// kubectl-cilium does not have to stream full map dumps over the exec channel:
+//
+//	$ bpf-map-count /sys/fs/bpf/tc/globals/cilium_ct4_global
+//	{"entries":284970,"max_entries":356212}
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/gyutaeb/kubectl-cilium/internal/bpfcount"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintf(os.Stderr, "usage: %s <pinned map path>\n", bpfcount.HelperName)
+		os.Exit(2)
+	}
+
+	count, err := bpfcount.CountPinned(os.Args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = json.NewEncoder(os.Stdout).Encode(count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}